@@ -1,26 +1,106 @@
 package microbatcher
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/clock"
 	"microbatcher/pkg/configs"
+	"microbatcher/pkg/idempotency"
 	"microbatcher/pkg/processor"
+	"microbatcher/pkg/ratelimit"
 	"microbatcher/pkg/types"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Batcher is the contract of a micro batcher. It allows to name a batcher in struct fields and to replace it
+// with alternative implementations, such as the fake of the batchertest package.
+type Batcher[I types.JobId, T any] interface {
+	Submit(job *types.Job[I, T]) (*types.JobResult[I, T], error)
+	SubmitAt(job *types.Job[I, T], notBefore time.Time) (*types.JobResult[I, T], error)
+	SubmitMany(jobs []*types.Job[I, T], mode SubmitMode) ([]Admission[I, T], error)
+	Status(id I) (*types.JobResult[I, T], bool)
+	TakeDelayed() []*types.Job[I, T]
+	Start() error
+	Shutdown() error
+	Flush(ctx context.Context) error
+	Pause() error
+	Resume() error
+	IsPaused() bool
+	Stats() Stats
+	GetCurrentResults() []*types.JobResult[I, T]
+	Subscribe(subscriber func(results []*types.JobResult[I, T])) (unsubscribe func())
+	SubscribeBatches(subscriber func(batchResult *types.BatchResult[I, T])) (unsubscribe func())
+	GetBreakerState() breaker.State
+	SetDispatchRateLimit(batches ratelimit.Limit, items ratelimit.Limit)
+	SetSubmitRateLimit(submit ratelimit.Limit)
+}
+
+var _ Batcher[int, string] = (*microBatcher[int, string])(nil)
+
+// rateLimits holds the token buckets of the batcher. Buckets without configured limit are unlimited,
+// so that limits can still be set at runtime.
+type rateLimits struct {
+	policy          ratelimit.Policy
+	dispatchBatches *ratelimit.TokenBucket
+	dispatchItems   *ratelimit.TokenBucket
+	submit          *ratelimit.TokenBucket
+}
+
+// subscribers holds the functions receiving the recorded results, or the recorded batch results, by subscription
+// ID.
+type subscribers[I types.JobId, T any] struct {
+	mutex          sync.Mutex
+	nextId         int
+	functions      map[int]func(results []*types.JobResult[I, T])
+	batchFunctions map[int]func(batchResult *types.BatchResult[I, T])
+}
+
+// idempotencyKeys holds the idempotency store of the batcher and the keys of the jobs in flight by job ID.
+type idempotencyKeys[I types.JobId, T any] struct {
+	mutex sync.Mutex
+	store idempotency.Store[I, T]
+	keys  map[I]string
+}
+
+// grouping holds the key function which splits batches into groups, and the maximum size of a group batch by group.
+type grouping[I types.JobId, T any] struct {
+	key     func(job *types.Job[I, T]) string
+	maxSize func(group string) int
+}
+
 type microBatcher[I types.JobId, T any] struct {
 	name         string
 	processor    processor.BatchProcessor[I, T]
 	config       configs.BatcherConfig
+	clock        clock.Clock
+	breaker      *breaker.CircuitBreaker
+	rateLimits   rateLimits
 	results      []*types.JobResult[I, T]
 	resultsMutex sync.Mutex
+	subscribers  subscribers[I, T]
+	idempotency  idempotencyKeys[I, T]
+	tracker      *statusTracker[I, T]
+	delayed      *delayQueue[I, T]
+	grouping     grouping[I, T]
+	metrics      metrics
 	running      bool
 	runningMutex sync.Mutex
+	queueMutex   sync.Mutex
+	paused       atomic.Bool
+	wake         chan struct{}
 	jobs         chan *types.Job[I, T]
+	dequeued     chan struct{}
 	shutdown     chan struct{}
+	stopped      chan struct{}
+	unschedule   chan struct{}
+	unscheduled  chan struct{}
+	flushes      chan chan error
 	wg           sync.WaitGroup
 }
 
@@ -31,31 +111,279 @@ func NewMicroBatcher[I types.JobId, T any](
 	processor processor.BatchProcessor[I, T],
 	config configs.BatcherConfig,
 ) *microBatcher[I, T] {
-	return &microBatcher[I, T]{
+	mb := &microBatcher[I, T]{
 		name:      name,
 		processor: processor,
 		config:    config,
+		clock:     config.GetClock(),
+		delayed:   newDelayQueue[I, T](),
+	}
+	mb.tracker = newStatusTracker[I, T](config.GetStatusRetentionJobs(), config.GetStatusRetentionTTL())
+	if breakerConfig := config.GetCircuitBreaker(); breakerConfig != nil {
+		mb.breaker = breaker.New(name, *breakerConfig, mb.clock)
+	}
+
+	rateLimitConfig := config.GetRateLimit()
+	if rateLimitConfig == nil {
+		rateLimitConfig = &ratelimit.Config{}
+	}
+	mb.rateLimits = rateLimits{
+		policy:          rateLimitConfig.GetPolicy(),
+		dispatchBatches: ratelimit.NewTokenBucket(rateLimitConfig.GetDispatchBatches(), mb.clock),
+		dispatchItems:   ratelimit.NewTokenBucket(rateLimitConfig.GetDispatchItems(), mb.clock),
+		submit:          ratelimit.NewTokenBucket(rateLimitConfig.GetSubmit(), mb.clock),
 	}
+	return mb
 }
 
-// Submit submits a new job to the internal job queue and returns a job result with accepted state.
+// Submit submits a new job to the internal job queue and returns a job result with queued state.
+// When the submission rate limit is exceeded, Submit either waits for admission or returns ErrRateLimited.
+// With an idempotency store, a resubmitted job is not queued again. Submit returns its cached result once it
+// is completed, or the accepted result of the job in flight otherwise.
 func (mb *microBatcher[I, T]) Submit(job *types.Job[I, T]) (*types.JobResult[I, T], error) {
+	result, known, err := mb.reserveKey(job)
+	if err != nil || known {
+		return result, err
+	}
+
+	result, err = mb.enqueue(job)
+	if err != nil {
+		mb.releaseKey(job)
+	}
+	return result, err
+}
+
+// enqueue checks the batcher before the rate limit charges a token, or even waits for it, and returns the token
+// when the job is rejected after all, since the queue may fill up in the meantime.
+func (mb *microBatcher[I, T]) enqueue(job *types.Job[I, T]) (*types.JobResult[I, T], error) {
+	if err := mb.admissible(1); err != nil {
+		return nil, err
+	}
+	if err := mb.admit(); err != nil {
+		return nil, err
+	}
+
 	mb.runningMutex.Lock()
 	defer mb.runningMutex.Unlock()
 
 	if !mb.running {
-		return nil, errors.New("invalid submission since batcher is not started")
+		mb.rateLimits.submit.Return(1)
+		return nil, ErrNotStarted
 	}
 
-	select {
-	case mb.jobs <- job:
-		slog.Info(fmt.Sprintf("%s submits %s", mb.name, job))
-		return &types.JobResult[I, T]{ID: job.ID}, nil
-	default:
-		return nil, errors.New("job queue is full")
+	// the job is tracked before it is queued, since the execute loop may take it straight away
+	result := mb.submittedResult(job.ID, types.JobStatusQueued)
+	previous := mb.tracker.submit(result)
+	if mb.offer([]*types.Job[I, T]{job}, SubmitAllOrNothing) == 0 {
+		mb.tracker.restore(job.ID, previous)
+		mb.rateLimits.submit.Return(1)
+		return nil, ErrQueueFull
+	}
+	slog.Info(fmt.Sprintf("%s submits %s", mb.name, job))
+	return result, nil
+}
+
+// SubmitAt submits a new job which is not batched before the given time, and returns a job result with accepted
+// state. The job is kept in a delay queue until it is due and then moved into the job queue. Delayed jobs are
+// kept over a shutdown and scheduled again by the next start, unless they are taken by TakeDelayed.
+func (mb *microBatcher[I, T]) SubmitAt(job *types.Job[I, T], notBefore time.Time) (*types.JobResult[I, T], error) {
+	if !notBefore.After(mb.clock.Now()) {
+		return mb.Submit(job)
+	}
+
+	result, known, err := mb.reserveKey(job)
+	if err != nil || known {
+		return result, err
+	}
+
+	result, err = mb.delay(job, notBefore)
+	if err != nil {
+		mb.releaseKey(job)
+	}
+	return result, err
+}
+
+// delay checks the batcher before the rate limit charges a token, like enqueue. The delay queue has no capacity.
+func (mb *microBatcher[I, T]) delay(job *types.Job[I, T], notBefore time.Time) (*types.JobResult[I, T], error) {
+	if err := mb.admissible(0); err != nil {
+		return nil, err
+	}
+	if err := mb.admit(); err != nil {
+		return nil, err
+	}
+
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	if !mb.running {
+		mb.rateLimits.submit.Return(1)
+		return nil, ErrNotStarted
+	}
+
+	result := mb.submittedResult(job.ID, types.JobStatusAccepted)
+	mb.tracker.submit(result)
+	mb.delayed.push(job, notBefore)
+	slog.Info(fmt.Sprintf("%s delays %s until %s", mb.name, job, notBefore.Format(time.RFC3339)))
+	return result, nil
+}
+
+// submittedResult builds the result which responds to the submission of a job.
+func (mb *microBatcher[I, T]) submittedResult(id I, status types.JobStatus) *types.JobResult[I, T] {
+	return &types.JobResult[I, T]{ID: id, Status: status, SubmittedAt: mb.clock.Now(), Batcher: mb.name}
+}
+
+// TakeDelayed removes the delayed jobs which are not due yet and returns them in order of their time, e.g. to
+// persist them after a shutdown. Their idempotency keys are released, so that they can be submitted again.
+func (mb *microBatcher[I, T]) TakeDelayed() []*types.Job[I, T] {
+	delayed := mb.delayed.takeAll()
+	mb.tracker.forget(delayed...)
+	for _, job := range delayed {
+		mb.releaseKey(job)
+	}
+	return delayed
+}
+
+// Status returns the lifecycle state of a job by its ID, i.e. accepted while delayed, queued while it waits in the
+// job queue or in the pending batch, processing while its batch is processed, and its final result once it is
+// finished. Finished jobs are kept by the status retention policy of the config. Status reports false for jobs
+// which are unknown, rejected or no longer retained.
+func (mb *microBatcher[I, T]) Status(id I) (*types.JobResult[I, T], bool) {
+	return mb.tracker.status(id, mb.clock.Now())
+}
+
+// admit applies the submission rate limit according to the rate limit policy.
+func (mb *microBatcher[I, T]) admit() error {
+	if mb.rateLimits.policy == ratelimit.PolicyReject {
+		if !mb.rateLimits.submit.Allow(1) {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	return mb.rateLimits.submit.Wait(context.Background(), 1)
+}
+
+// SetIdempotencyStore sets the store which recognizes resubmitted jobs by their idempotency key, or by their ID
+// when they have no key. It must be set before the batcher is started.
+func (mb *microBatcher[I, T]) SetIdempotencyStore(store idempotency.Store[I, T]) error {
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	if mb.running {
+		return errors.New("invalid idempotency store since batcher is started")
+	}
+
+	mb.idempotency.mutex.Lock()
+	defer mb.idempotency.mutex.Unlock()
+
+	mb.idempotency.store = store
+	mb.idempotency.keys = make(map[I]string)
+	return nil
+}
+
+// SetGroupBy splits every batch into group batches of the jobs with the same key, so that the processor is called
+// once per group, e.g. per account or per endpoint. A group batch contains at most the max group size of its group
+// of jobs, where a size below one is taken as one, and the group batches of a flush are dispatched round-robin
+// across groups. A nil key function disables the grouping. It must be set before the batcher is started.
+func (mb *microBatcher[I, T]) SetGroupBy(
+	key func(job *types.Job[I, T]) string,
+	maxGroupSize func(group string) int,
+) error {
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	if mb.running {
+		return errors.New("invalid group by since batcher is started")
+	}
+
+	if key != nil && maxGroupSize == nil {
+		return errors.New("maxGroupSize must be set")
+	}
+
+	mb.grouping = grouping[I, T]{key: key, maxSize: maxGroupSize}
+	return nil
+}
+
+// reserveKey reserves the idempotency key of the job. For a known key it returns the result to respond with.
+func (mb *microBatcher[I, T]) reserveKey(job *types.Job[I, T]) (*types.JobResult[I, T], bool, error) {
+	mb.idempotency.mutex.Lock()
+	defer mb.idempotency.mutex.Unlock()
+
+	if mb.idempotency.store == nil {
+		return nil, false, nil
+	}
+
+	key := idempotencyKeyOf(job)
+	entry, known, err := mb.idempotency.store.Reserve(key, job.ID, mb.clock.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	if known {
+		slog.Info(fmt.Sprintf("%s recognizes resubmitted %s by key %s", mb.name, job, key))
+		if entry.Completed() {
+			return entry.Result, true, nil
+		}
+		return &types.JobResult[I, T]{ID: entry.ID, Status: types.JobStatusAccepted, Batcher: mb.name}, true, nil
+	}
+
+	mb.idempotency.keys[job.ID] = key
+	return nil, false, nil
+}
+
+// releaseKey forgets the idempotency key of a rejected job, so that it can be submitted again.
+func (mb *microBatcher[I, T]) releaseKey(job *types.Job[I, T]) {
+	mb.idempotency.mutex.Lock()
+	defer mb.idempotency.mutex.Unlock()
+
+	key, ok := mb.idempotency.keys[job.ID]
+	if !ok {
+		return
+	}
+	delete(mb.idempotency.keys, job.ID)
+	if err := mb.idempotency.store.Release(key); err != nil {
+		slog.Error(fmt.Sprintf("%s fails to release idempotency key %s: %s", mb.name, key, err))
+	}
+}
+
+// completeKeys caches the results by the idempotency keys of their jobs.
+func (mb *microBatcher[I, T]) completeKeys(results []*types.JobResult[I, T]) {
+	mb.idempotency.mutex.Lock()
+	defer mb.idempotency.mutex.Unlock()
+
+	if mb.idempotency.store == nil {
+		return
+	}
+
+	now := mb.clock.Now()
+	for _, result := range results {
+		key, ok := mb.idempotency.keys[result.ID]
+		if !ok {
+			continue
+		}
+		delete(mb.idempotency.keys, result.ID)
+		if err := mb.idempotency.store.Complete(key, result, now); err != nil {
+			slog.Error(fmt.Sprintf("%s fails to complete idempotency key %s: %s", mb.name, key, err))
+		}
 	}
 }
 
+func idempotencyKeyOf[I types.JobId, T any](job *types.Job[I, T]) string {
+	if job.IdempotencyKey != "" {
+		return job.IdempotencyKey
+	}
+	return fmt.Sprint(job.ID)
+}
+
+// SetDispatchRateLimit adjusts the limits of batches and jobs dispatched to the processor at runtime.
+func (mb *microBatcher[I, T]) SetDispatchRateLimit(batches ratelimit.Limit, items ratelimit.Limit) {
+	mb.rateLimits.dispatchBatches.SetLimit(batches)
+	mb.rateLimits.dispatchItems.SetLimit(items)
+}
+
+// SetSubmitRateLimit adjusts the limit of submitted jobs at runtime.
+func (mb *microBatcher[I, T]) SetSubmitRateLimit(submit ratelimit.Limit) {
+	mb.rateLimits.submit.SetLimit(submit)
+}
+
 // Start starts the batch process goroutine which execute custom processor either by either timer
 // or size constraint
 func (mb *microBatcher[I, T]) Start() error {
@@ -72,14 +400,84 @@ func (mb *microBatcher[I, T]) Start() error {
 	// init channels here. This is helpful to
 	// let batcher can be shutdown and start again
 	mb.jobs = make(chan *types.Job[I, T], mb.config.GetJobQueueSize())
+	mb.dequeued = make(chan struct{}, 1)
 	mb.shutdown = make(chan struct{})
+	mb.stopped = make(chan struct{})
+	mb.flushes = make(chan chan error)
+	mb.wake = make(chan struct{}, 1)
+	mb.unschedule = make(chan struct{})
+	mb.unscheduled = make(chan struct{})
 	mb.results = nil
 
 	mb.wg.Add(1)
 	go mb.execute()
+	go mb.schedule()
 	return nil
 }
 
+// GetBreakerState returns the state of the circuit breaker. A batcher without circuit breaker is always closed.
+func (mb *microBatcher[I, T]) GetBreakerState() breaker.State {
+	if mb.breaker == nil {
+		return breaker.StateClosed
+	}
+	return mb.breaker.State()
+}
+
+// queueDepth returns the number of jobs in the job queue.
+func (mb *microBatcher[I, T]) queueDepth() int {
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	if !mb.running {
+		return 0
+	}
+	return len(mb.jobs)
+}
+
+// Subscribe registers a function which receives the results of every batch once they are recorded. It is called
+// from the batch process goroutine, so a slow subscriber holds up the batcher. The returned function unsubscribes.
+func (mb *microBatcher[I, T]) Subscribe(subscriber func(results []*types.JobResult[I, T])) (unsubscribe func()) {
+	mb.subscribers.mutex.Lock()
+	defer mb.subscribers.mutex.Unlock()
+
+	if mb.subscribers.functions == nil {
+		mb.subscribers.functions = make(map[int]func(results []*types.JobResult[I, T]))
+	}
+	id := mb.subscribers.nextId
+	mb.subscribers.nextId++
+	mb.subscribers.functions[id] = subscriber
+
+	return func() {
+		mb.subscribers.mutex.Lock()
+		defer mb.subscribers.mutex.Unlock()
+
+		delete(mb.subscribers.functions, id)
+	}
+}
+
+// SubscribeBatches registers a function which receives the batch result of every recorded batch, including its
+// batch error and metadata. Like for Subscribe, the function is called by the batch process goroutine.
+func (mb *microBatcher[I, T]) SubscribeBatches(
+	subscriber func(batchResult *types.BatchResult[I, T]),
+) (unsubscribe func()) {
+	mb.subscribers.mutex.Lock()
+	defer mb.subscribers.mutex.Unlock()
+
+	if mb.subscribers.batchFunctions == nil {
+		mb.subscribers.batchFunctions = make(map[int]func(batchResult *types.BatchResult[I, T]))
+	}
+	id := mb.subscribers.nextId
+	mb.subscribers.nextId++
+	mb.subscribers.batchFunctions[id] = subscriber
+
+	return func() {
+		mb.subscribers.mutex.Lock()
+		defer mb.subscribers.mutex.Unlock()
+
+		delete(mb.subscribers.batchFunctions, id)
+	}
+}
+
 // GetCurrentResults returns the all current of processed jobs
 func (mb *microBatcher[I, T]) GetCurrentResults() []*types.JobResult[I, T] {
 	mb.resultsMutex.Lock()
@@ -90,6 +488,124 @@ func (mb *microBatcher[I, T]) GetCurrentResults() []*types.JobResult[I, T] {
 	return clonedResults
 }
 
+// Flush processes all pending and queued jobs in batches of the configured size straight away, and blocks until
+// their results are recorded or the context is done. Jobs held by an open circuit breaker stay pending, and
+// ErrCircuitOpen is returned in that case. A paused batcher does not flush and returns ErrPaused.
+func (mb *microBatcher[I, T]) Flush(ctx context.Context) error {
+	mb.runningMutex.Lock()
+	if !mb.running {
+		mb.runningMutex.Unlock()
+		return errors.New("invalid flush since batcher is not started")
+	}
+	flushes, stopped := mb.flushes, mb.stopped
+	mb.runningMutex.Unlock()
+
+	done := make(chan error, 1)
+	select {
+	case flushes <- done:
+	case <-stopped:
+		// shutting down processes all jobs as well
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops dispatching batches to the processor while jobs are still accepted. The batch timer is suspended
+// and jobs are queued until Resume is called. A batch already in process is not interrupted.
+func (mb *microBatcher[I, T]) Pause() error {
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	if !mb.running {
+		return errors.New("invalid pause since batcher is not started")
+	}
+
+	if !mb.paused.CompareAndSwap(false, true) {
+		return errors.New("batcher is paused already")
+	}
+	slog.Info(fmt.Sprintf("%s pauses", mb.name))
+	mb.wakeUp()
+	return nil
+}
+
+// Resume resumes dispatching batches. The jobs accumulated while paused are processed in batches of the
+// configured size straight away.
+func (mb *microBatcher[I, T]) Resume() error {
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	if !mb.running {
+		return errors.New("invalid resume since batcher is not started")
+	}
+
+	if !mb.paused.CompareAndSwap(true, false) {
+		return errors.New("batcher is not paused")
+	}
+	slog.Info(fmt.Sprintf("%s resumes", mb.name))
+	mb.wakeUp()
+	return nil
+}
+
+// IsPaused reports whether the batch dispatch is paused.
+func (mb *microBatcher[I, T]) IsPaused() bool {
+	return mb.paused.Load()
+}
+
+// Stats returns a snapshot of the state of the batcher.
+func (mb *microBatcher[I, T]) Stats() Stats {
+	mb.runningMutex.Lock()
+	running := mb.running
+	queueDepth := 0
+	if running {
+		queueDepth = len(mb.jobs)
+	}
+	mb.runningMutex.Unlock()
+
+	var breakerCounts breaker.Counts
+	if mb.breaker != nil {
+		breakerCounts = mb.breaker.Counts()
+	}
+
+	mb.metrics.mutex.Lock()
+	defer mb.metrics.mutex.Unlock()
+
+	return Stats{
+		Name:             mb.name,
+		Running:          running,
+		Paused:           mb.paused.Load(),
+		QueueDepth:       queueDepth,
+		QueueCapacity:    mb.config.GetJobQueueSize(),
+		PendingBatchSize: mb.metrics.pendingBatchSize,
+		DelayedJobs:      mb.delayed.len(),
+		BatchesProcessed: mb.metrics.batchesProcessed,
+		JobsProcessed:    mb.metrics.jobsProcessed,
+		JobsFailed:       mb.metrics.jobsFailed,
+		JobsExpired:      mb.metrics.jobsExpired,
+		LastError:        mb.metrics.lastError,
+		LastFlushTime:    mb.metrics.lastFlushTime,
+		BreakerState:     mb.GetBreakerState(),
+		BreakerCounts:    breakerCounts,
+	}
+}
+
+// wakeUp lets the execute loop pick up a changed paused state. The channel is buffered by one, so a pending
+// wake up is enough.
+func (mb *microBatcher[I, T]) wakeUp() {
+	select {
+	case mb.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown processes all accepted jobs, even when the batcher is paused, and stops the batch process goroutine.
 func (mb *microBatcher[I, T]) Shutdown() error {
 	mb.runningMutex.Lock()
 	defer mb.runningMutex.Unlock()
@@ -98,6 +614,9 @@ func (mb *microBatcher[I, T]) Shutdown() error {
 		return errors.New("invalid shutdown since batcher is stopped")
 	}
 	slog.Info(fmt.Sprintf("%s starts shutting down", mb.name))
+	// stop moving due jobs into the job queue first, so that the job queue is drained completely
+	close(mb.unschedule)
+	<-mb.unscheduled
 	// send shutdown signal via channel
 	close(mb.shutdown)
 	// wait for the process goroutine to be finished
@@ -106,6 +625,7 @@ func (mb *microBatcher[I, T]) Shutdown() error {
 	close(mb.jobs)
 
 	mb.running = false
+	mb.paused.Store(false)
 	slog.Info(fmt.Sprintf("%s shuts down", mb.name))
 
 	return nil
@@ -113,64 +633,516 @@ func (mb *microBatcher[I, T]) Shutdown() error {
 
 func (mb *microBatcher[I, T]) execute() {
 	defer mb.wg.Done()
+	defer close(mb.stopped)
 
-	timer := time.NewTimer(mb.config.GetBatchProcessFrequency())
+	timer := mb.clock.NewTimer(mb.config.GetBatchProcessFrequency())
 	defer timer.Stop()
 
 	// rely on local batch job slice to monitor the in-taking batch size
 	var batchJobs []*types.Job[I, T]
 	for {
+		mb.metrics.setPendingBatchSize(len(batchJobs))
+
+		// a full batch is only left pending while the circuit breaker holds the dispatch, and a paused batcher
+		// keeps up to a job queue size of jobs pending. Stop taking jobs in that case, so that the job queue
+		// fills up and rejects submissions.
+		jobs := mb.jobs
+		paused := mb.paused.Load()
+		if (!paused && len(batchJobs) >= mb.config.GetBatchProcessSize()) ||
+			(paused && len(batchJobs) >= mb.config.GetJobQueueSize()) {
+			jobs = nil
+		}
+
 		select {
-		case job := <-mb.jobs:
+		case job := <-jobs:
+			mb.nudgeDequeued()
 			batchJobs = append(batchJobs, job)
 			// invoke custom processor when batch size is reached
-			if len(batchJobs) >= mb.config.GetBatchProcessSize() {
-				mb.processBatch(batchJobs, timer)
-				batchJobs = nil
+			if len(batchJobs) >= mb.config.GetBatchProcessSize() && !mb.paused.Load() {
+				batchJobs = mb.processBatch(batchJobs, timer, false)
+			}
+		case <-timer.C():
+			if mb.paused.Load() {
+				// the timer stays suspended until resumed
+				continue
 			}
-		case <-timer.C:
 			if len(batchJobs) > 0 {
 				// Process batch on timer trigger
-				mb.processBatch(batchJobs, timer)
-				batchJobs = nil
+				batchJobs = mb.processBatch(batchJobs, timer, false)
+			} else {
+				timer.Reset(mb.config.GetBatchProcessFrequency())
+			}
+		case <-mb.wake:
+			if mb.paused.Load() {
+				timer.Stop()
+				continue
+			}
+			// resumed, so process the accumulated jobs. The timer is reset by the batch process, or here
+			// when nothing is pending.
+			timer.Reset(mb.config.GetBatchProcessFrequency())
+			batchJobs = mb.processAll(batchJobs, timer, false)
+		case done := <-mb.flushes:
+			if mb.paused.Load() {
+				done <- ErrPaused
+			} else if batchJobs = mb.processAll(mb.drainQueue(batchJobs), timer, false); len(batchJobs) > 0 {
+				done <- ErrCircuitOpen
 			}
+			close(done)
 		case <-mb.shutdown:
 			// handle shutdown case
-			batchJobs = mb.drainQueue(batchJobs)
-			if len(batchJobs) > 0 {
-				mb.processBatch(batchJobs, timer)
+			mb.processAll(mb.drainQueue(batchJobs), timer, true)
+			return
+		}
+	}
+}
+
+// schedule moves the delayed jobs into the job queue once they are due. Moving a job waits while the job queue
+// is full until the execute loop takes a job, which keeps the job in order and applies the backpressure of the job
+// queue to delayed jobs as well.
+func (mb *microBatcher[I, T]) schedule() {
+	defer close(mb.unscheduled)
+
+	timer := mb.clock.NewTimer(mb.config.GetBatchProcessFrequency())
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		var due <-chan time.Time
+		if notBefore, ok := mb.delayed.next(); ok {
+			now := mb.clock.Now()
+			if wait := notBefore.Sub(now); wait > 0 {
+				timer.Reset(wait)
+				due = timer.C()
+			} else if delayed, ok := mb.delayed.popDue(now); ok {
+				if mb.offer([]*types.Job[I, T]{delayed.job}, SubmitAllOrNothing) > 0 {
+					mb.tracker.queue(delayed.job)
+					slog.Info(fmt.Sprintf("%s submits due %s", mb.name, delayed.job))
+					continue
+				}
+				mb.delayed.pushBack(delayed)
+				select {
+				case <-mb.dequeued:
+					continue
+				case <-mb.unschedule:
+					return
+				}
 			}
+		}
+
+		select {
+		case <-due:
+		case <-mb.delayed.changed:
+			timer.Stop()
+		case <-mb.unschedule:
 			return
 		}
 	}
 }
 
-func (mb *microBatcher[I, T]) processBatch(batchJobs []*types.Job[I, T], timer *time.Timer) {
+// processBatch dispatches the batch jobs to the custom processor and returns the jobs which are left pending
+// since the circuit breaker holds the dispatch. Held jobs are failed fast on shutdown instead.
+func (mb *microBatcher[I, T]) processBatch(
+	batchJobs []*types.Job[I, T],
+	timer clock.Timer,
+	shuttingDown bool,
+) []*types.Job[I, T] {
 	// need to stop and reset the timer since the batch process
 	timer.Stop()
 	defer timer.Reset(mb.config.GetBatchProcessFrequency())
 
+	// expired jobs are completed straight away rather than being dispatched
+	if batchJobs = mb.expire(batchJobs); len(batchJobs) == 0 {
+		return nil
+	}
+
+	// the circuit breaker is asked per group batch, so that a breaker which opens on the outcome of a group batch
+	// stops the remaining group batches
+	groups := mb.groupBatch(batchJobs)
+	for i, group := range groups {
+		if mb.breaker != nil && !mb.breaker.Allow() {
+			if mb.breaker.Policy() == breaker.PolicyHold && !shuttingDown {
+				held := slices.Concat(groups[i:]...)
+				slog.Info(fmt.Sprintf("%s holds batch of %d jobs since circuit breaker is open", mb.name, len(held)))
+				return held
+			}
+			slog.Warn(fmt.Sprintf("%s fails batch of %d jobs since circuit breaker is open", mb.name, len(group)))
+			mb.recordResults(&types.BatchResult[I, T]{Results: failedResults(group, ErrCircuitOpen), Error: ErrCircuitOpen})
+			continue
+		}
+		mb.dispatch(group)
+	}
+	return nil
+}
+
+// processAll dispatches the jobs in batches of the configured size and returns the jobs which are left pending
+// since the circuit breaker holds the dispatch.
+func (mb *microBatcher[I, T]) processAll(
+	batchJobs []*types.Job[I, T],
+	timer clock.Timer,
+	shuttingDown bool,
+) []*types.Job[I, T] {
+	for len(batchJobs) > 0 {
+		size := min(len(batchJobs), mb.config.GetBatchProcessSize())
+		if pending := mb.processBatch(batchJobs[:size], timer, shuttingDown); pending != nil {
+			// the held jobs no longer contain the jobs which expired
+			return append(pending, batchJobs[size:]...)
+		}
+		batchJobs = batchJobs[size:]
+	}
+	return nil
+}
+
+// dispatch calls the processor for the batch jobs and records their results.
+func (mb *microBatcher[I, T]) dispatch(batchJobs []*types.Job[I, T]) {
+	// throttle the dispatch. Waiting here stops the execute loop from taking jobs, so the job queue
+	// fills up and the submissions are throttled in turn.
+	_ = mb.rateLimits.dispatchBatches.Wait(context.Background(), 1)
+	_ = mb.rateLimits.dispatchItems.Wait(context.Background(), len(batchJobs))
+
 	// call custom processor to process the batch jobs
 	slog.Info(fmt.Sprintf("%s starts batch process", mb.name))
-	results := mb.processor.Process(batchJobs)
+	startedAt := mb.clock.Now()
+	sequence := mb.metrics.recordBatch(startedAt)
+	mb.tracker.start(batchJobs, startedAt, sequence)
+	attempts := 1
+	batchResult := mb.invokeProcessor(batchJobs)
+	retries := mb.config.GetBatchRetries()
+	maxRetryAfter := mb.config.GetMaxBatchRetryAfter()
+	for retry := 1; retry <= retries && batchResult.Error != nil && batchResult.RetryAfter > 0; retry++ {
+		if batchResult.RetryAfter > maxRetryAfter {
+			slog.Warn(fmt.Sprintf("%s does not retry failed batch, since retry after %s exceeds %s",
+				mb.name, batchResult.RetryAfter, maxRetryAfter))
+			break
+		}
+		slog.Warn(fmt.Sprintf("%s retries failed batch after %s (%d/%d): %s",
+			mb.name, batchResult.RetryAfter, retry, retries, batchResult.Error))
+		if !mb.sleep(batchResult.RetryAfter) {
+			slog.Warn(fmt.Sprintf("%s does not retry failed batch, since it shuts down", mb.name))
+			break
+		}
+		attempts++
+		batchResult = mb.invokeProcessor(batchJobs)
+	}
+	if len(batchJobs) > 1 && batchResult.Failed() && mb.config.GetBisectStrategy() != configs.BisectNone {
+		slog.Warn(fmt.Sprintf("%s bisects failed batch of %d jobs", mb.name, len(batchJobs)))
+		batchResult = mb.bisect(batchJobs, 1, attempts)
+	}
+	for _, result := range batchResult.Results {
+		result.StartedAt = startedAt
+		result.BatchSequence = sequence
+		if result.Attempts == 0 {
+			result.Attempts = attempts
+		}
+	}
+	if mb.breaker != nil {
+		mb.breaker.Record(!batchResult.Failed())
+	}
+
+	switch {
+	case batchResult.Error != nil:
+		slog.Error(fmt.Sprintf("%s batch process failed, request id %q: %s",
+			mb.name, batchResult.RequestID, batchResult.Error))
+	case batchResult.PartialFailure:
+		slog.Warn(fmt.Sprintf("%s batch process failed partially, request id %q", mb.name, batchResult.RequestID))
+	}
 
 	// cache this batch results in the batcher
-	mb.recordResults(results)
+	mb.recordResults(batchResult)
+	if dropped := mb.tracker.drop(batchJobs, mb.clock.Now()); dropped > 0 {
+		slog.Warn(fmt.Sprintf("%s batch process returned no result for %d jobs", mb.name, dropped))
+	}
+}
+
+// sleep blocks the execute loop for the given duration of the batcher clock. It returns false when the batcher
+// shuts down in the meantime, so that the shutdown is not held up.
+func (mb *microBatcher[I, T]) sleep(d time.Duration) bool {
+	timer := mb.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return true
+	case <-mb.shutdown:
+		return false
+	}
+}
+
+// groupBatch splits the batch jobs by the group key into group batches of at most the max size of their group. The
+// group batches take turns across groups in order of their first job, so that a large group does not delay the others.
+func (mb *microBatcher[I, T]) groupBatch(batchJobs []*types.Job[I, T]) [][]*types.Job[I, T] {
+	if mb.grouping.key == nil {
+		return [][]*types.Job[I, T]{batchJobs}
+	}
+
+	var keys []string
+	groups := make(map[string][]*types.Job[I, T])
+	for _, job := range batchJobs {
+		key := mb.grouping.key(job)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], job)
+	}
+
+	var groupBatches [][]*types.Job[I, T]
+	for len(keys) > 0 {
+		remaining := keys[:0]
+		for _, key := range keys {
+			group := groups[key]
+			size := min(len(group), max(mb.grouping.maxSize(key), 1))
+			groupBatches = append(groupBatches, group[:size])
+			if groups[key] = group[size:]; len(groups[key]) > 0 {
+				remaining = append(remaining, key)
+			}
+		}
+		keys = remaining
+	}
+	return groupBatches
+}
+
+// expire completes the jobs whose deadline has passed with ErrJobExpired and returns the other jobs.
+func (mb *microBatcher[I, T]) expire(batchJobs []*types.Job[I, T]) []*types.Job[I, T] {
+	now := mb.clock.Now()
+	var expired []*types.Job[I, T]
+	for _, job := range batchJobs {
+		if job.Expired(now) {
+			expired = append(expired, job)
+		}
+	}
+	if len(expired) == 0 {
+		return batchJobs
+	}
+
+	slog.Warn(fmt.Sprintf("%s expires %d jobs of batch", mb.name, len(expired)))
+	mb.metrics.recordExpired(len(expired))
+	expiredResults := failedResults(expired, ErrJobExpired)
+	for _, result := range expiredResults {
+		result.Status = types.JobStatusExpired
+	}
+	mb.recordResults(&types.BatchResult[I, T]{Results: expiredResults})
+
+	unexpired := make([]*types.Job[I, T], 0, len(batchJobs)-len(expired))
+	for _, job := range batchJobs {
+		if !job.Expired(now) {
+			unexpired = append(unexpired, job)
+		}
+	}
+	return unexpired
+}
+
+// bisect splits a failed batch by the bisect strategy and processes the parts again. Parts which fail as a whole
+// are split again until the max depth is reached, so that only the jobs failing on their own end up with errors.
+// The results count the attempts of their jobs, on top of the given attempts of the failed batch.
+func (mb *microBatcher[I, T]) bisect(batchJobs []*types.Job[I, T], depth int, attempts int) *types.BatchResult[I, T] {
+	var parts [][]*types.Job[I, T]
+	if mb.config.GetBisectStrategy() == configs.BisectSingles {
+		for i := range batchJobs {
+			parts = append(parts, batchJobs[i:i+1])
+		}
+	} else {
+		middle := len(batchJobs) / 2
+		parts = [][]*types.Job[I, T]{batchJobs[:middle], batchJobs[middle:]}
+	}
+
+	batchResult := &types.BatchResult[I, T]{Results: make([]*types.JobResult[I, T], 0, len(batchJobs))}
+	for _, part := range parts {
+		partResult := mb.invokeProcessor(part)
+		if len(part) > 1 && partResult.Failed() && depth < mb.config.GetBisectMaxDepth() {
+			partResult = mb.bisect(part, depth+1, attempts)
+		}
+		for _, result := range partResult.Results {
+			// results of deeper parts are counted already
+			if result.Attempts == 0 {
+				result.Attempts = attempts + depth
+			}
+		}
+		batchResult.Results = append(batchResult.Results, partResult.Results...)
+	}
+	batchResult.PartialFailure = partiallyFailed(batchResult.Results)
+	return batchResult
+}
+
+// invokeProcessor calls the custom processor and bounds it by the batch timeout if configured. When the timeout
+// is exceeded, the processor's context is cancelled and every job of the batch gets ErrBatchTimeout so that the
+// execute loop can move on to the next batch. The timed out batch has the batch process frequency as retry hint,
+// so that it is retried under the batch retries. The processor call is not waited for, so it may still run while
+// the next batch is processed.
+func (mb *microBatcher[I, T]) invokeProcessor(batchJobs []*types.Job[I, T]) *types.BatchResult[I, T] {
+	timeout := mb.config.GetBatchTimeout()
+	if timeout <= 0 {
+		return mb.callProcessor(context.Background(), batchJobs)
+	}
+
+	// the timeout is measured by the batcher clock rather than by context.WithTimeout
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := mb.clock.NewTimer(timeout)
+	defer timer.Stop()
+
+	// buffered so the processor goroutine does not leak on send once the batch is timed out
+	done := make(chan *types.BatchResult[I, T], 1)
+	go func() {
+		done <- mb.callProcessor(ctx, batchJobs)
+	}()
+
+	select {
+	case batchResult := <-done:
+		return batchResult
+	case <-timer.C():
+		slog.Warn(fmt.Sprintf("%s batch process timed out after %s", mb.name, timeout))
+		return &types.BatchResult[I, T]{
+			Results:    failedResults(batchJobs, ErrBatchTimeout),
+			Error:      ErrBatchTimeout,
+			RetryAfter: mb.config.GetBatchProcessFrequency(),
+		}
+	}
+}
+
+// callProcessor calls the most capable method of the processor and completes the batch result. Nil results are
+// removed, jobs without result get the batch error, when there is one, and a batch with failed and succeeded jobs
+// is partially failed.
+func (mb *microBatcher[I, T]) callProcessor(
+	ctx context.Context,
+	batchJobs []*types.Job[I, T],
+) *types.BatchResult[I, T] {
+	var batchResult *types.BatchResult[I, T]
+	switch batchProcessor := mb.processor.(type) {
+	case processor.BatchResultProcessor[I, T]:
+		batchResult = batchProcessor.ProcessBatch(ctx, batchJobs)
+		if batchResult == nil {
+			batchResult = &types.BatchResult[I, T]{}
+		}
+	case processor.ContextBatchProcessor[I, T]:
+		batchResult = &types.BatchResult[I, T]{Results: batchProcessor.ProcessContext(ctx, batchJobs)}
+	default:
+		batchResult = &types.BatchResult[I, T]{Results: batchProcessor.Process(batchJobs)}
+	}
+
+	// nil results count as jobs without result, which are tracked as dropped
+	batchResult.Results = slices.DeleteFunc(batchResult.Results, func(result *types.JobResult[I, T]) bool {
+		return result == nil
+	})
+	if batchResult.Error != nil {
+		returned := make(map[I]bool, len(batchResult.Results))
+		for _, result := range batchResult.Results {
+			returned[result.ID] = true
+		}
+		for _, job := range batchJobs {
+			if !returned[job.ID] {
+				batchResult.Results = append(batchResult.Results, &types.JobResult[I, T]{ID: job.ID, Errors: batchResult.Error})
+			}
+		}
+	}
+	batchResult.PartialFailure = batchResult.PartialFailure || partiallyFailed(batchResult.Results)
+	return batchResult
+}
+
+// partiallyFailed reports whether some of the results carry an error while others do not.
+func partiallyFailed[I types.JobId, T any](results []*types.JobResult[I, T]) bool {
+	failed := 0
+	for _, result := range results {
+		if result.Errors != nil {
+			failed++
+		}
+	}
+	return failed > 0 && failed < len(results)
+}
+
+// failedResults builds one result per job carrying the given error.
+func failedResults[I types.JobId, T any](batchJobs []*types.Job[I, T], err error) []*types.JobResult[I, T] {
+	results := make([]*types.JobResult[I, T], 0, len(batchJobs))
+	for _, job := range batchJobs {
+		results = append(results, &types.JobResult[I, T]{ID: job.ID, Errors: err})
+	}
+	return results
 }
 
 // The mutex here since the GetCurrentResults function. Read and write in different goroutine and GetCurrentResults
 // can be called by external anytime they need. Therefore, the mutex of results is needed here.
-func (mb *microBatcher[I, T]) recordResults(newResults []*types.JobResult[I, T]) {
-	mb.resultsMutex.Lock()
-	defer mb.resultsMutex.Unlock()
+// The results are stamped with the batcher name, their finish time and their final status first, and tracked with
+// the submission time of their jobs.
+func (mb *microBatcher[I, T]) recordResults(batchResult *types.BatchResult[I, T]) {
+	newResults := batchResult.Results
+	finishedAt := mb.clock.Now()
+	failed := 0
+	var lastError error
+	for _, result := range newResults {
+		result.Batcher = mb.name
+		result.FinishedAt = finishedAt
+		if !result.Status.Done() {
+			result.Status = types.JobStatusSucceeded
+			if result.Errors != nil {
+				result.Status = types.JobStatusFailed
+			}
+		}
+		if result.Errors != nil {
+			failed++
+			lastError = result.Errors
+		}
+	}
+	mb.tracker.finish(newResults, finishedAt)
+	mb.metrics.recordJobs(len(newResults), failed, lastError)
+	mb.completeKeys(newResults)
 
+	mb.resultsMutex.Lock()
 	mb.results = append(mb.results, newResults...)
+	mb.resultsMutex.Unlock()
+
+	mb.notifySubscribers(batchResult)
+}
+
+// failRecorded fails the recorded result of the job afterwards, e.g. when a pipeline cannot forward it to the next
+// stage. The result is replaced by a failed copy, since recorded results are shared with the callers.
+func (mb *microBatcher[I, T]) failRecorded(id I, err error) {
+	mb.resultsMutex.Lock()
+	for i := len(mb.results) - 1; i >= 0; i-- {
+		if mb.results[i].ID == id {
+			failed := *mb.results[i]
+			failed.Errors = err
+			failed.Status = types.JobStatusFailed
+			mb.results[i] = &failed
+			break
+		}
+	}
+	mb.resultsMutex.Unlock()
+
+	mb.tracker.fail(id, err)
+	mb.metrics.recordJobs(0, 1, err)
+}
+
+func (mb *microBatcher[I, T]) notifySubscribers(batchResult *types.BatchResult[I, T]) {
+	mb.subscribers.mutex.Lock()
+	functions := make([]func(results []*types.JobResult[I, T]), 0, len(mb.subscribers.functions))
+	for _, subscriber := range mb.subscribers.functions {
+		functions = append(functions, subscriber)
+	}
+	batchFunctions := make([]func(batchResult *types.BatchResult[I, T]), 0, len(mb.subscribers.batchFunctions))
+	for _, subscriber := range mb.subscribers.batchFunctions {
+		batchFunctions = append(batchFunctions, subscriber)
+	}
+	mb.subscribers.mutex.Unlock()
+
+	for _, subscriber := range functions {
+		subscriber(batchResult.Results)
+	}
+	for _, subscriber := range batchFunctions {
+		subscriber(batchResult)
+	}
+}
+
+// nudgeDequeued tells the scheduler that the job queue has capacity again.
+func (mb *microBatcher[I, T]) nudgeDequeued() {
+	select {
+	case mb.dequeued <- struct{}{}:
+	default:
+	}
 }
 
 func (mb *microBatcher[I, T]) drainQueue(batchJobs []*types.Job[I, T]) []*types.Job[I, T] {
 	for {
 		select {
 		case job := <-mb.jobs:
+			mb.nudgeDequeued()
 			batchJobs = append(batchJobs, job)
 		default:
 			// no more to drain
@@ -1,9 +1,18 @@
 package microbatcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/clock"
 	"microbatcher/pkg/configs"
+	"microbatcher/pkg/idempotency"
+	"microbatcher/pkg/processor"
+	"microbatcher/pkg/ratelimit"
 	"microbatcher/pkg/types"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -140,6 +149,9 @@ func TestMicroBatcherProcessByTimer(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clock.NewFake(time.Now())
+			tt.config.SetClock(fakeClock)
+
 			mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, tt.config)
 			startErr := mb.Start()
 			assert.Nil(t, startErr)
@@ -157,7 +169,19 @@ func TestMicroBatcherProcessByTimer(t *testing.T) {
 				}
 			}
 
-			time.Sleep(2 * time.Second)
+			// wait for the batch timer to be armed and for all jobs to be taken off the queue
+			fakeClock.BlockUntilTimers(1)
+			assert.Eventually(t, func() bool {
+				return mb.queueDepth() == 0
+			}, time.Second, time.Millisecond)
+
+			fakeClock.Advance(tt.config.GetBatchProcessFrequency() - time.Millisecond)
+			assert.Empty(t, mb.GetCurrentResults())
+
+			fakeClock.Advance(time.Millisecond)
+			assert.Eventually(t, func() bool {
+				return len(mb.GetCurrentResults()) == len(tt.expectedJobResults)
+			}, time.Second, time.Millisecond)
 
 			shutdownErr := mb.Shutdown()
 			assert.Nil(t, shutdownErr)
@@ -340,3 +364,1248 @@ func TestMicroBatcherSubmitErrorSinceQueueIsFull(t *testing.T) {
 		})
 	}
 }
+
+type TestingContextMicroBatcherProcess[I types.JobId] struct {
+	TestingMicroBatcherProcess[I]
+	cancelled chan struct{}
+}
+
+func (tm *TestingContextMicroBatcherProcess[I]) ProcessContext(
+	ctx context.Context,
+	jobs []*types.Job[I, string],
+) []*types.JobResult[I, string] {
+	<-ctx.Done()
+	close(tm.cancelled)
+	return nil
+}
+
+func TestMicroBatcherBatchTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		batchTimeout time.Duration
+		processor    func() *TestingMicroBatcherProcess[string]
+	}{
+		{
+			name:         "Slow batch process is timed out and the batcher moves on",
+			batchTimeout: 100 * time.Millisecond,
+			processor: func() *TestingMicroBatcherProcess[string] {
+				return &TestingMicroBatcherProcess[string]{
+					slow:          true,
+					sleepDuration: 1 * time.Minute,
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := configs.NewCustomConfig(10, 3, 5*time.Second)
+			assert.Nil(t, cfg.SetBatchTimeout(tt.batchTimeout))
+
+			mb := NewMicroBatcher("tester", tt.processor(), cfg)
+			assert.Nil(t, mb.Start())
+
+			// two batches by size, the second one only runs once the first one is timed out
+			for i := 0; i < 6; i++ {
+				_, err := mb.Submit(&types.Job[string, string]{ID: fmt.Sprintf("job%d", i)})
+				assert.Nil(t, err)
+			}
+
+			assert.Eventually(t, func() bool {
+				return len(mb.GetCurrentResults()) == 6
+			}, 2*time.Second, 10*time.Millisecond)
+
+			for _, result := range mb.GetCurrentResults() {
+				assert.ErrorIs(t, result.Errors, ErrBatchTimeout)
+			}
+			assert.Nil(t, mb.Shutdown())
+		})
+	}
+}
+
+func TestMicroBatcherBatchTimeoutCancelsProcessorContext(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 1, 5*time.Second)
+	assert.Nil(t, cfg.SetBatchTimeout(50*time.Millisecond))
+
+	processor := &TestingContextMicroBatcherProcess[string]{cancelled: make(chan struct{})}
+	mb := NewMicroBatcher("tester", processor, cfg)
+	assert.Nil(t, mb.Start())
+
+	_, err := mb.Submit(&types.Job[string, string]{ID: "job1"})
+	assert.Nil(t, err)
+
+	select {
+	case <-processor.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("processor context is not cancelled")
+	}
+	assert.Nil(t, mb.Shutdown())
+
+	results := mb.GetCurrentResults()
+	assert.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Errors, ErrBatchTimeout)
+}
+
+type TestingTimeoutOnceMicroBatcherProcess[I types.JobId] struct {
+	TestingMicroBatcherProcess[I]
+	calls atomic.Int32
+}
+
+// ProcessContext blocks the first call until its context is cancelled, and processes the jobs of later calls.
+func (tm *TestingTimeoutOnceMicroBatcherProcess[I]) ProcessContext(
+	ctx context.Context,
+	jobs []*types.Job[I, string],
+) []*types.JobResult[I, string] {
+	if tm.calls.Add(1) == 1 {
+		<-ctx.Done()
+		return nil
+	}
+	return tm.Process(jobs)
+}
+
+func TestMicroBatcherBatchTimeoutIsRetried(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 1, 10*time.Millisecond)
+	assert.Nil(t, cfg.SetBatchTimeout(50*time.Millisecond))
+	assert.Nil(t, cfg.SetBatchRetries(1))
+
+	processor := &TestingTimeoutOnceMicroBatcherProcess[string]{}
+	mb := NewMicroBatcher("tester", processor, cfg)
+	assert.Nil(t, mb.Start())
+
+	_, err := mb.Submit(&types.Job[string, string]{ID: "job1"})
+	assert.Nil(t, err)
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Nil(t, mb.Shutdown())
+
+	results := mb.GetCurrentResults()
+	assert.Len(t, results, 1)
+	assert.Nil(t, results[0].Errors)
+	assert.Equal(t, 2, results[0].Attempts)
+	assert.Equal(t, int32(2), processor.calls.Load())
+}
+
+type TestingFailingMicroBatcherProcess[I types.JobId] struct {
+	failures atomic.Int32
+}
+
+// Process fails the whole batch as long as there are failures left.
+func (tm *TestingFailingMicroBatcherProcess[I]) Process(jobs []*types.Job[I, string]) []*types.JobResult[I, string] {
+	var err error
+	if tm.failures.Add(-1) >= 0 {
+		err = errors.New("downstream is down")
+	}
+
+	results := make([]*types.JobResult[I, string], 0)
+	for _, job := range jobs {
+		results = append(results, &types.JobResult[I, string]{
+			ID:     job.ID,
+			Data:   fmt.Sprintf("%v is processed", job.ID),
+			Errors: err,
+		})
+	}
+	return results
+}
+
+func TestMicroBatcherCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         breaker.Policy
+		openTimeout    time.Duration
+		expectedErrors map[string]error
+		expectedState  breaker.State
+	}{
+		{
+			name:        "Open circuit breaker fails batches fast",
+			policy:      breaker.PolicyFailFast,
+			openTimeout: 1 * time.Minute,
+			expectedErrors: map[string]error{
+				"job2": ErrCircuitOpen,
+				"job3": ErrCircuitOpen,
+			},
+			expectedState: breaker.StateOpen,
+		},
+		{
+			name:        "Open circuit breaker holds batches until the probe succeeds",
+			policy:      breaker.PolicyHold,
+			openTimeout: 200 * time.Millisecond,
+			expectedErrors: map[string]error{
+				"job2": nil,
+				"job3": nil,
+			},
+			expectedState: breaker.StateClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transitions []breaker.State
+			breakerConfig, _ := breaker.NewCustomConfig(1, 1, 1, tt.openTimeout, 1, tt.policy)
+			breakerConfig.SetOnStateChange(func(from, to breaker.State) {
+				transitions = append(transitions, to)
+			})
+			cfg, _ := configs.NewCustomConfig(10, 1, 50*time.Millisecond)
+			cfg.SetCircuitBreaker(breakerConfig)
+
+			processor := &TestingFailingMicroBatcherProcess[string]{}
+			processor.failures.Store(1)
+			mb := NewMicroBatcher("tester", processor, cfg)
+			assert.Nil(t, mb.Start())
+
+			for _, job := range jobs {
+				_, err := mb.Submit(job)
+				assert.Nil(t, err)
+			}
+
+			assert.Eventually(t, func() bool {
+				return len(mb.GetCurrentResults()) == len(jobs)
+			}, 2*time.Second, 10*time.Millisecond)
+			assert.Nil(t, mb.Shutdown())
+
+			for _, result := range mb.GetCurrentResults() {
+				if result.ID == "job1" {
+					assert.EqualError(t, result.Errors, "downstream is down")
+					continue
+				}
+				assert.Equal(t, tt.expectedErrors[result.ID], result.Errors)
+			}
+			assert.Equal(t, tt.expectedState, mb.GetBreakerState())
+			assert.Equal(t, tt.expectedState, transitions[len(transitions)-1])
+		})
+	}
+}
+
+func TestMicroBatcherCircuitBreakerPerGroup(t *testing.T) {
+	breakerConfig, _ := breaker.NewCustomConfig(1, 1, 1, time.Minute, 1, breaker.PolicyFailFast)
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	cfg.SetCircuitBreaker(breakerConfig)
+
+	processor := &TestingFailingMicroBatcherProcess[int]{}
+	processor.failures.Store(1)
+	mb := NewMicroBatcher("tester", processor, cfg)
+	assert.Nil(t, mb.SetGroupBy(func(job *types.Job[int, string]) string { return job.Data }, groupSize(10)))
+	assert.Nil(t, mb.Start())
+
+	for i, account := range []string{"a", "b", "c"} {
+		_, err := mb.Submit(&types.Job[int, string]{ID: i, Data: account})
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Nil(t, mb.Shutdown())
+
+	// the first group opens the breaker, so the other groups of the batch are not dispatched
+	assert.Equal(t, int32(0), processor.failures.Load())
+	results := mb.GetCurrentResults()
+	assert.Len(t, results, 3)
+	for _, result := range results {
+		if result.ID == 0 {
+			assert.EqualError(t, result.Errors, "downstream is down")
+			continue
+		}
+		assert.Equal(t, ErrCircuitOpen, result.Errors)
+	}
+}
+
+func TestMicroBatcherSubmitRateLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        ratelimit.Policy
+		expectedError error
+	}{
+		{
+			name:          "Submission over the limit is rejected",
+			policy:        ratelimit.PolicyReject,
+			expectedError: ErrRateLimited,
+		},
+		{
+			name:          "Submission over the limit waits for admission",
+			policy:        ratelimit.PolicyWait,
+			expectedError: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimitConfig, _ := ratelimit.NewCustomConfig(
+				ratelimit.Limit{}, ratelimit.Limit{}, ratelimit.Limit{Rate: 10, Burst: 2}, tt.policy,
+			)
+			cfg := configs.NewDefaultConfig()
+			cfg.SetRateLimit(rateLimitConfig)
+
+			mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+			assert.Nil(t, mb.Start())
+
+			var lastErr error
+			for _, job := range jobs {
+				_, lastErr = mb.Submit(job)
+			}
+			assert.Equal(t, tt.expectedError, lastErr)
+
+			// lifting the limit at runtime admits straight away
+			mb.SetSubmitRateLimit(ratelimit.Limit{})
+			_, err := mb.Submit(&types.Job[string, string]{ID: "job4"})
+			assert.Nil(t, err)
+			assert.Nil(t, mb.Shutdown())
+		})
+	}
+}
+
+func TestMicroBatcherSubmitRateLimitRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ratelimit.Policy
+	}{
+		{
+			name:   "Rejected submission does not take a token",
+			policy: ratelimit.PolicyReject,
+		},
+		{
+			name:   "Rejected submission does not wait for a token",
+			policy: ratelimit.PolicyWait,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimitConfig, _ := ratelimit.NewCustomConfig(
+				ratelimit.Limit{}, ratelimit.Limit{}, ratelimit.Limit{Rate: 1, Burst: 1}, tt.policy,
+			)
+			cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+			cfg.SetRateLimit(rateLimitConfig)
+			// the fake time never refills the bucket, so a second token is never available
+			cfg.SetClock(clock.NewFake(time.Now()))
+			mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+
+			for _, job := range jobs {
+				_, err := mb.Submit(job)
+				assert.Equal(t, ErrNotStarted, err)
+				_, err = mb.SubmitAt(job, time.Now().Add(time.Hour))
+				assert.Equal(t, ErrNotStarted, err)
+			}
+			admissions, err := mb.SubmitMany(jobs, SubmitBestEffort)
+			assert.Nil(t, err)
+			for _, admission := range admissions {
+				assert.Equal(t, ErrNotStarted, admission.Err)
+			}
+
+			assert.Nil(t, mb.Start())
+			_, err = mb.Submit(jobs[0])
+			assert.Nil(t, err)
+			assert.Nil(t, mb.Shutdown())
+		})
+	}
+}
+
+func TestMicroBatcherDispatchRateLimit(t *testing.T) {
+	rateLimitConfig, _ := ratelimit.NewCustomConfig(
+		ratelimit.Limit{Rate: 10, Burst: 1}, ratelimit.Limit{}, ratelimit.Limit{}, ratelimit.PolicyWait,
+	)
+	cfg, _ := configs.NewCustomConfig(10, 1, 5*time.Second)
+	cfg.SetRateLimit(rateLimitConfig)
+
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+	assert.Nil(t, mb.Start())
+
+	start := time.Now()
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		return len(mb.GetCurrentResults()) == len(jobs)
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// three batches of one job at 10 batches per second with a burst of one
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+	assert.Nil(t, mb.Shutdown())
+}
+
+func TestMicroBatcherSubscribe(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 3, 5*time.Second)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+
+	var received []*types.JobResult[string, string]
+	unsubscribe := mb.Subscribe(func(results []*types.JobResult[string, string]) {
+		received = append(received, results...)
+	})
+	var unsubscribed []*types.JobResult[string, string]
+	mb.Subscribe(func(results []*types.JobResult[string, string]) {
+		unsubscribed = append(unsubscribed, results...)
+	})()
+
+	assert.Nil(t, mb.Start())
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mb.Shutdown())
+	unsubscribe()
+
+	assert.Equal(t, mb.GetCurrentResults(), received)
+	assert.Empty(t, unsubscribed)
+}
+
+func TestMicroBatcherFlush(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 2, 5*time.Second)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+
+	var batchSizes []int
+	mb.Subscribe(func(results []*types.JobResult[string, string]) {
+		batchSizes = append(batchSizes, len(results))
+	})
+
+	assert.EqualError(t, mb.Flush(context.Background()), "invalid flush since batcher is not started")
+	assert.Nil(t, mb.Start())
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Len(t, mb.GetCurrentResults(), len(jobs))
+	assert.Equal(t, []int{2, 1}, batchSizes)
+
+	// nothing is pending anymore
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Equal(t, []int{2, 1}, batchSizes)
+	assert.Nil(t, mb.Shutdown())
+}
+
+func TestMicroBatcherFlushError(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        func() configs.BatcherConfig
+		processor     func() processor.BatchProcessor[string, string]
+		expectedError error
+	}{
+		{
+			name: "Flush is bounded by the context",
+			config: func() configs.BatcherConfig {
+				cfg, _ := configs.NewCustomConfig(10, 3, 5*time.Second)
+				return cfg
+			},
+			processor: func() processor.BatchProcessor[string, string] {
+				return &TestingMicroBatcherProcess[string]{slow: true, sleepDuration: 1 * time.Second}
+			},
+			expectedError: context.DeadlineExceeded,
+		},
+		{
+			name: "Flush reports jobs held by the circuit breaker",
+			config: func() configs.BatcherConfig {
+				breakerConfig, _ := breaker.NewCustomConfig(1, 1, 1, 1*time.Minute, 1, breaker.PolicyHold)
+				cfg, _ := configs.NewCustomConfig(10, 1, 5*time.Second)
+				cfg.SetCircuitBreaker(breakerConfig)
+				return cfg
+			},
+			processor: func() processor.BatchProcessor[string, string] {
+				processor := &TestingFailingMicroBatcherProcess[string]{}
+				processor.failures.Store(1)
+				return processor
+			},
+			expectedError: ErrCircuitOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mb := NewMicroBatcher("tester", tt.processor(), tt.config())
+			assert.Nil(t, mb.Start())
+			for _, job := range jobs {
+				_, err := mb.Submit(job)
+				assert.Nil(t, err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			assert.ErrorIs(t, mb.Flush(ctx), tt.expectedError)
+			assert.Nil(t, mb.Shutdown())
+		})
+	}
+}
+
+func TestMicroBatcherPauseAndResume(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	cfg, _ := configs.NewCustomConfig(20, 2, 1*time.Second)
+	cfg.SetClock(fakeClock)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+
+	var batchSizes []int
+	mb.Subscribe(func(results []*types.JobResult[string, string]) {
+		batchSizes = append(batchSizes, len(results))
+	})
+
+	assert.EqualError(t, mb.Pause(), "invalid pause since batcher is not started")
+	assert.Nil(t, mb.Start())
+	assert.EqualError(t, mb.Resume(), "batcher is not paused")
+	assert.Nil(t, mb.Pause())
+	assert.EqualError(t, mb.Pause(), "batcher is paused already")
+	assert.True(t, mb.IsPaused())
+
+	// jobs are still accepted, but neither the batch size nor the timer dispatches them
+	for i := 0; i < 5; i++ {
+		_, err := mb.Submit(&types.Job[string, string]{ID: fmt.Sprintf("job%d", i)})
+		assert.Nil(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		return mb.queueDepth() == 0
+	}, time.Second, time.Millisecond)
+	fakeClock.Advance(5 * time.Second)
+	assert.ErrorIs(t, mb.Flush(context.Background()), ErrPaused)
+	assert.Empty(t, mb.GetCurrentResults())
+
+	assert.Nil(t, mb.Resume())
+	assert.False(t, mb.IsPaused())
+	assert.Eventually(t, func() bool {
+		return len(mb.GetCurrentResults()) == 5
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, mb.Shutdown())
+	assert.Equal(t, []int{2, 2, 1}, batchSizes)
+}
+
+func TestMicroBatcherShutdownWhilePaused(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 2, 5*time.Second)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+	assert.Nil(t, mb.Start())
+	assert.Nil(t, mb.Pause())
+
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+
+	// shutdown processes all accepted jobs regardless of the pause
+	assert.Nil(t, mb.Shutdown())
+	assert.Len(t, mb.GetCurrentResults(), len(jobs))
+	assert.False(t, mb.IsPaused())
+}
+
+type TestingPoisonMicroBatcherProcess[I types.JobId] struct {
+	mutex      sync.Mutex
+	batchSizes []int
+}
+
+// Process fails the whole batch when any of its jobs is poison.
+func (tm *TestingPoisonMicroBatcherProcess[I]) Process(jobs []*types.Job[I, string]) []*types.JobResult[I, string] {
+	tm.mutex.Lock()
+	tm.batchSizes = append(tm.batchSizes, len(jobs))
+	tm.mutex.Unlock()
+
+	var err error
+	for _, job := range jobs {
+		if job.Data == "poison" {
+			err = fmt.Errorf("batch contains poison job %v", job.ID)
+		}
+	}
+
+	results := make([]*types.JobResult[I, string], 0, len(jobs))
+	for _, job := range jobs {
+		results = append(results, &types.JobResult[I, string]{ID: job.ID, Data: job.Data, Errors: err})
+	}
+	return results
+}
+
+func TestMicroBatcherBisect(t *testing.T) {
+	tests := []struct {
+		name               string
+		bisectStrategy     configs.BisectStrategy
+		bisectMaxDepth     int
+		expectedBatchSizes []int
+		expectedFailed     []int
+		expectedAttempts   []int
+	}{
+		{
+			name:               "Failed batch is kept without bisect",
+			bisectStrategy:     configs.BisectNone,
+			expectedBatchSizes: []int{8},
+			expectedFailed:     []int{0, 1, 2, 3, 4, 5, 6, 7},
+			expectedAttempts:   []int{1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:               "Failed batch is bisected in halves down to the poison job",
+			bisectStrategy:     configs.BisectHalves,
+			bisectMaxDepth:     3,
+			expectedBatchSizes: []int{8, 4, 4, 2, 1, 1, 2},
+			expectedFailed:     []int{5},
+			expectedAttempts:   []int{2, 2, 2, 2, 4, 4, 3, 3},
+		},
+		{
+			name:               "Failed batch is bisected in halves up to the max depth",
+			bisectStrategy:     configs.BisectHalves,
+			bisectMaxDepth:     1,
+			expectedBatchSizes: []int{8, 4, 4},
+			expectedFailed:     []int{4, 5, 6, 7},
+			expectedAttempts:   []int{2, 2, 2, 2, 2, 2, 2, 2},
+		},
+		{
+			name:               "Failed batch is bisected in singles",
+			bisectStrategy:     configs.BisectSingles,
+			bisectMaxDepth:     1,
+			expectedBatchSizes: []int{8, 1, 1, 1, 1, 1, 1, 1, 1},
+			expectedFailed:     []int{5},
+			expectedAttempts:   []int{2, 2, 2, 2, 2, 2, 2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := configs.NewCustomConfig(16, 8, 5*time.Second)
+			assert.Nil(t, cfg.SetBisect(tt.bisectStrategy, tt.bisectMaxDepth))
+			processor := &TestingPoisonMicroBatcherProcess[int]{}
+			mb := NewMicroBatcher("tester", processor, cfg)
+			assert.Nil(t, mb.Start())
+
+			for i := 0; i < 8; i++ {
+				data := fmt.Sprintf("data%d", i)
+				if i == 5 {
+					data = "poison"
+				}
+				_, err := mb.Submit(&types.Job[int, string]{ID: i, Data: data})
+				assert.Nil(t, err)
+			}
+			assert.Nil(t, mb.Flush(context.Background()))
+			assert.Nil(t, mb.Shutdown())
+
+			results := mb.GetCurrentResults()
+			assert.Len(t, results, 8)
+			var failed []int
+			for i, result := range results {
+				assert.Equal(t, i, result.ID)
+				assert.Equal(t, tt.expectedAttempts[i], result.Attempts)
+				if result.Errors != nil {
+					assert.EqualError(t, result.Errors, "batch contains poison job 5")
+					failed = append(failed, result.ID)
+				}
+			}
+			assert.Equal(t, tt.expectedFailed, failed)
+			assert.Equal(t, tt.expectedBatchSizes, processor.batchSizes)
+		})
+	}
+}
+
+func TestMicroBatcherIdempotency(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 3, 5*time.Second)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+	store, _ := idempotency.NewMemoryStore[string, string](time.Minute)
+	assert.Nil(t, mb.SetIdempotencyStore(store))
+	assert.Nil(t, mb.Start())
+	assert.EqualError(t, mb.SetIdempotencyStore(store), "invalid idempotency store since batcher is started")
+
+	// a resubmission in flight gets the accepted result and is not queued again
+	result, err := mb.Submit(&types.Job[string, string]{ID: "job1", Data: "data1"})
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusQueued, result.Status)
+	result, err = mb.Submit(&types.Job[string, string]{ID: "job1", Data: "data1"})
+	assert.Nil(t, err)
+	assert.Equal(t, &types.JobResult[string, string]{ID: "job1", Status: types.JobStatusAccepted, Batcher: "tester"}, result)
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Len(t, mb.GetCurrentResults(), 1)
+
+	// a resubmission of a completed job gets the cached result
+	result, err = mb.Submit(&types.Job[string, string]{ID: "job1", Data: "data1"})
+	assert.Nil(t, err)
+	assert.Equal(t, mb.GetCurrentResults()[0], result)
+
+	// an explicit key identifies resubmissions with another ID
+	_, err = mb.Submit(&types.Job[string, string]{ID: "job2", IdempotencyKey: "key"})
+	assert.Nil(t, err)
+	assert.Nil(t, mb.Flush(context.Background()))
+	result, err = mb.Submit(&types.Job[string, string]{ID: "job3", IdempotencyKey: "key"})
+	assert.Nil(t, err)
+	assert.Equal(t, mb.GetCurrentResults()[1], result)
+
+	assert.Nil(t, mb.Shutdown())
+	assert.Len(t, mb.GetCurrentResults(), 2)
+
+	// a rejected job is released, so that it can be submitted again
+	_, err = mb.Submit(&types.Job[string, string]{ID: "job4"})
+	assert.ErrorIs(t, err, ErrNotStarted)
+	_, known, _ := store.Reserve("job4", "job4", time.Now())
+	assert.False(t, known)
+}
+
+func TestMicroBatcherSubmitAt(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	fakeClock := clock.NewFake(time.Now())
+	cfg.SetClock(fakeClock)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+
+	_, err := mb.SubmitAt(jobs[0], fakeClock.Now().Add(time.Second))
+	assert.ErrorIs(t, err, ErrNotStarted)
+	assert.Nil(t, mb.Start())
+
+	// jobs are batched in order of their time, and jobs which are due already are submitted straight away
+	expectedStatuses := []types.JobStatus{types.JobStatusAccepted, types.JobStatusAccepted, types.JobStatusQueued}
+	for i, delay := range []time.Duration{10 * time.Second, 5 * time.Second, 0} {
+		result, submitErr := mb.SubmitAt(jobs[i], fakeClock.Now().Add(delay))
+		assert.Nil(t, submitErr)
+		assert.Equal(t, &types.JobResult[string, string]{
+			ID:          jobs[i].ID,
+			Status:      expectedStatuses[i],
+			SubmittedAt: fakeClock.Now(),
+			Batcher:     "tester",
+		}, result)
+	}
+	assert.Equal(t, 2, mb.Stats().DelayedJobs)
+
+	// the batch timer and the delay timer are armed
+	fakeClock.BlockUntilTimers(2)
+	fakeClock.Advance(5 * time.Second)
+	assert.Eventually(t, func() bool {
+		assert.Nil(t, mb.Flush(context.Background()))
+		return len(mb.GetCurrentResults()) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "job3", mb.GetCurrentResults()[0].ID)
+	assert.Equal(t, "job2", mb.GetCurrentResults()[1].ID)
+
+	// the delayed job is kept over a shutdown and scheduled by the next start
+	assert.Nil(t, mb.Shutdown())
+	assert.Equal(t, 1, mb.Stats().DelayedJobs)
+	assert.Nil(t, mb.Start())
+	fakeClock.BlockUntilTimers(2)
+	fakeClock.Advance(5 * time.Second)
+	assert.Eventually(t, func() bool {
+		assert.Nil(t, mb.Flush(context.Background()))
+		return len(mb.GetCurrentResults()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "job1", mb.GetCurrentResults()[0].ID)
+
+	// delayed jobs which are not due at shutdown can be taken
+	_, err = mb.SubmitAt(jobs[1], fakeClock.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	_, err = mb.SubmitAt(jobs[0], fakeClock.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Nil(t, mb.Shutdown())
+	assert.Equal(t, []*types.Job[string, string]{jobs[0], jobs[1]}, mb.TakeDelayed())
+	assert.Equal(t, 0, mb.Stats().DelayedJobs)
+}
+
+func TestMicroBatcherTakeDelayedReleasesKeys(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+	store, _ := idempotency.NewMemoryStore[string, string](time.Minute)
+	assert.Nil(t, mb.SetIdempotencyStore(store))
+	assert.Nil(t, mb.Start())
+
+	// a taken job is submitted again rather than recognized as in flight
+	_, err := mb.SubmitAt(jobs[0], time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, mb.TakeDelayed(), 1)
+	result, err := mb.Submit(jobs[0])
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusQueued, result.Status)
+
+	assert.Nil(t, mb.Shutdown())
+	assert.Len(t, mb.GetCurrentResults(), 1)
+}
+
+func TestMicroBatcherJobDeadline(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	fakeClock := clock.NewFake(time.Now())
+	cfg.SetClock(fakeClock)
+	processor := &TestingPoisonMicroBatcherProcess[string]{}
+	mb := NewMicroBatcher("tester", processor, cfg)
+	assert.Nil(t, mb.Start())
+
+	deadlines := []time.Duration{time.Second, 0, time.Minute}
+	for i, job := range jobs {
+		deadlined := *job
+		if deadlines[i] > 0 {
+			deadlined.Deadline = fakeClock.Now().Add(deadlines[i])
+		}
+		_, err := mb.Submit(&deadlined)
+		assert.Nil(t, err)
+	}
+
+	// the job sat in the queue past its deadline
+	fakeClock.Advance(2 * time.Second)
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Nil(t, mb.Shutdown())
+
+	results := mb.GetCurrentResults()
+	assert.Len(t, results, 3)
+	assert.Equal(t, "job1", results[0].ID)
+	assert.ErrorIs(t, results[0].Errors, ErrJobExpired)
+	assert.Equal(t, types.JobStatusExpired, results[0].Status)
+	for _, result := range results[1:] {
+		assert.Nil(t, result.Errors)
+		assert.Equal(t, types.JobStatusSucceeded, result.Status)
+	}
+	assert.Equal(t, []int{2}, processor.batchSizes)
+
+	stats := mb.Stats()
+	assert.Equal(t, 1, stats.JobsExpired)
+	assert.Equal(t, 1, stats.JobsFailed)
+	assert.Equal(t, 1, stats.BatchesProcessed)
+}
+
+type TestingRecordingMicroBatcherProcess[I types.JobId] struct {
+	TestingMicroBatcherProcess[I]
+	mutex   sync.Mutex
+	batches [][]I
+}
+
+// Process records the job IDs of every batch.
+func (tm *TestingRecordingMicroBatcherProcess[I]) Process(jobs []*types.Job[I, string]) []*types.JobResult[I, string] {
+	ids := make([]I, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+
+	tm.mutex.Lock()
+	tm.batches = append(tm.batches, ids)
+	tm.mutex.Unlock()
+	return tm.TestingMicroBatcherProcess.Process(jobs)
+}
+
+// groupSize returns a max group size function which is the same for every group.
+func groupSize(size int) func(group string) int {
+	return func(string) int {
+		return size
+	}
+}
+
+func TestMicroBatcherGroupBy(t *testing.T) {
+	byAccount := func(job *types.Job[int, string]) string {
+		return job.Data
+	}
+
+	tests := []struct {
+		name            string
+		key             func(job *types.Job[int, string]) string
+		maxGroupSize    func(group string) int
+		accounts        []string
+		expectedBatches [][]int
+	}{
+		{
+			name:            "Batch is dispatched as a whole without grouping",
+			accounts:        []string{"a", "b", "a"},
+			expectedBatches: [][]int{{0, 1, 2}},
+		},
+		{
+			name:            "Batch is split by group",
+			key:             byAccount,
+			maxGroupSize:    groupSize(10),
+			accounts:        []string{"a", "b", "a", "c"},
+			expectedBatches: [][]int{{0, 2}, {1}, {3}},
+		},
+		{
+			name:            "Large group takes turns with the other groups",
+			key:             byAccount,
+			maxGroupSize:    groupSize(2),
+			accounts:        []string{"a", "a", "a", "a", "a", "b", "c", "c", "c"},
+			expectedBatches: [][]int{{0, 1}, {5}, {6, 7}, {2, 3}, {8}, {4}},
+		},
+		{
+			name: "Group batches have the max size of their group",
+			key:  byAccount,
+			maxGroupSize: func(group string) int {
+				if group == "a" {
+					return 3
+				}
+				return 0
+			},
+			accounts:        []string{"a", "a", "a", "a", "b", "b"},
+			expectedBatches: [][]int{{0, 1, 2}, {4}, {3}, {5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := configs.NewCustomConfig(20, 10, time.Hour)
+			processor := &TestingRecordingMicroBatcherProcess[int]{}
+			mb := NewMicroBatcher("tester", processor, cfg)
+			assert.Nil(t, mb.SetGroupBy(tt.key, tt.maxGroupSize))
+			assert.Nil(t, mb.Start())
+
+			for i, account := range tt.accounts {
+				_, err := mb.Submit(&types.Job[int, string]{ID: i, Data: account})
+				assert.Nil(t, err)
+			}
+			assert.Nil(t, mb.Flush(context.Background()))
+			assert.Nil(t, mb.Shutdown())
+
+			assert.Equal(t, tt.expectedBatches, processor.batches)
+			assert.Len(t, mb.GetCurrentResults(), len(tt.accounts))
+			assert.Equal(t, len(tt.expectedBatches), mb.Stats().BatchesProcessed)
+		})
+	}
+}
+
+func TestMicroBatcherGroupByError(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(20, 10, time.Hour)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[int]{}, cfg)
+	key := func(job *types.Job[int, string]) string { return job.Data }
+
+	assert.EqualError(t, mb.SetGroupBy(key, nil), "maxGroupSize must be set")
+	assert.Nil(t, mb.Start())
+	assert.EqualError(t, mb.SetGroupBy(key, groupSize(1)), "invalid group by since batcher is started")
+	assert.Nil(t, mb.Shutdown())
+}
+
+type TestingBatchResultMicroBatcherProcess[I types.JobId] struct {
+	TestingMicroBatcherProcess[I]
+	throttles atomic.Int32
+	calls     atomic.Int32
+}
+
+// ProcessBatch fails the whole batch with a retry hint as long as there are throttles left. Otherwise, it fails
+// the jobs with data "fail" and drops the jobs with data "drop".
+func (tm *TestingBatchResultMicroBatcherProcess[I]) ProcessBatch(
+	ctx context.Context,
+	jobs []*types.Job[I, string],
+) *types.BatchResult[I, string] {
+	requestID := fmt.Sprintf("request-%d", tm.calls.Add(1))
+	if tm.throttles.Add(-1) >= 0 {
+		return &types.BatchResult[I, string]{
+			Error:      errors.New("throttled"),
+			RequestID:  requestID,
+			RetryAfter: time.Second,
+		}
+	}
+
+	batchResult := &types.BatchResult[I, string]{RequestID: requestID, Metadata: map[string]string{"region": "eu"}}
+	for _, job := range jobs {
+		switch job.Data {
+		case "fail":
+			batchResult.Results = append(batchResult.Results, &types.JobResult[I, string]{ID: job.ID, Errors: errors.New("failed")})
+		case "drop":
+		default:
+			batchResult.Results = append(batchResult.Results, &types.JobResult[I, string]{ID: job.ID, Data: job.Data})
+		}
+	}
+	return batchResult
+}
+
+func TestMicroBatcherBatchResult(t *testing.T) {
+	tests := []struct {
+		name              string
+		throttles         int32
+		batchRetries      int
+		maxRetryAfter     time.Duration
+		data              []string
+		expectedErrors    []string
+		expectedCalls     int32
+		expectedRequestID string
+		expectedPartial   bool
+	}{
+		{
+			name:              "Batch result is published with its metadata",
+			data:              []string{"a", "fail", "drop"},
+			expectedErrors:    []string{"", "failed"},
+			expectedCalls:     1,
+			expectedRequestID: "request-1",
+			expectedPartial:   true,
+		},
+		{
+			name:              "Batch with retry hint is retried",
+			throttles:         2,
+			batchRetries:      2,
+			data:              []string{"a", "b"},
+			expectedErrors:    []string{"", ""},
+			expectedCalls:     3,
+			expectedRequestID: "request-3",
+		},
+		{
+			name:              "Batch error is set on every job once retries are exhausted",
+			throttles:         2,
+			batchRetries:      1,
+			data:              []string{"a", "b"},
+			expectedErrors:    []string{"throttled", "throttled"},
+			expectedCalls:     2,
+			expectedRequestID: "request-2",
+		},
+		{
+			name:              "Batch with retry hint beyond the max is not retried",
+			throttles:         1,
+			batchRetries:      2,
+			maxRetryAfter:     time.Millisecond * 500,
+			data:              []string{"a", "b"},
+			expectedErrors:    []string{"throttled", "throttled"},
+			expectedCalls:     1,
+			expectedRequestID: "request-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+			assert.Nil(t, cfg.SetBatchRetries(tt.batchRetries))
+			if tt.maxRetryAfter > 0 {
+				assert.Nil(t, cfg.SetMaxBatchRetryAfter(tt.maxRetryAfter))
+			}
+			fakeClock := clock.NewFake(time.Now())
+			cfg.SetClock(fakeClock)
+			processor := &TestingBatchResultMicroBatcherProcess[int]{}
+			processor.throttles.Store(tt.throttles)
+			mb := NewMicroBatcher("tester", processor, cfg)
+
+			var batchResults []*types.BatchResult[int, string]
+			mb.SubscribeBatches(func(batchResult *types.BatchResult[int, string]) {
+				batchResults = append(batchResults, batchResult)
+			})
+			assert.Nil(t, mb.Start())
+			for i, data := range tt.data {
+				_, err := mb.Submit(&types.Job[int, string]{ID: i, Data: data})
+				assert.Nil(t, err)
+			}
+
+			// advance the fake time while the batch waits for its retries
+			flushed := make(chan error)
+			go func() {
+				flushed <- mb.Flush(context.Background())
+			}()
+			for done := false; !done; {
+				select {
+				case err := <-flushed:
+					assert.Nil(t, err)
+					done = true
+				case <-time.After(10 * time.Millisecond):
+					fakeClock.Advance(time.Second)
+				}
+			}
+			assert.Nil(t, mb.Shutdown())
+
+			assert.Equal(t, tt.expectedCalls, processor.calls.Load())
+			assert.Len(t, batchResults, 1)
+			assert.Equal(t, tt.expectedRequestID, batchResults[0].RequestID)
+			assert.Equal(t, tt.expectedPartial, batchResults[0].PartialFailure)
+			results := mb.GetCurrentResults()
+			assert.Equal(t, batchResults[0].Results, results)
+			assert.Len(t, results, len(tt.expectedErrors))
+			for i, result := range results {
+				assert.Equal(t, int(tt.expectedCalls), result.Attempts)
+				if tt.expectedErrors[i] == "" {
+					assert.Nil(t, result.Errors)
+				} else {
+					assert.EqualError(t, result.Errors, tt.expectedErrors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMicroBatcherJobResultStamps(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 2, time.Hour)
+	fakeClock := clock.NewFake(time.Now())
+	cfg.SetClock(fakeClock)
+	mb := NewMicroBatcher("tester", &TestingPoisonMicroBatcherProcess[int]{}, cfg)
+	assert.Nil(t, mb.Start())
+
+	submittedAt := fakeClock.Now()
+	for i, data := range []string{"data0", "data1", "poison"} {
+		result, err := mb.Submit(&types.Job[int, string]{ID: i, Data: data})
+		assert.Nil(t, err)
+		assert.Equal(t, types.JobStatusQueued, result.Status)
+		assert.Equal(t, submittedAt, result.SubmittedAt)
+		assert.Equal(t, "tester", result.Batcher)
+	}
+
+	fakeClock.Advance(time.Second)
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Nil(t, mb.Shutdown())
+
+	results := mb.GetCurrentResults()
+	assert.Len(t, results, 3)
+	expectedStatuses := []types.JobStatus{types.JobStatusSucceeded, types.JobStatusSucceeded, types.JobStatusFailed}
+	expectedSequences := []int{1, 1, 2}
+	for i, result := range results {
+		assert.Equal(t, expectedStatuses[i], result.Status)
+		assert.Equal(t, expectedSequences[i], result.BatchSequence)
+		assert.Equal(t, 1, result.Attempts)
+		assert.Equal(t, "tester", result.Batcher)
+		assert.Equal(t, submittedAt, result.SubmittedAt)
+		assert.Equal(t, submittedAt.Add(time.Second), result.StartedAt)
+		assert.Equal(t, submittedAt.Add(time.Second), result.FinishedAt)
+	}
+}
+
+type TestingGatedMicroBatcherProcess[I types.JobId] struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+// Process signals the start of a batch and blocks until released. It returns no result for jobs with data "drop".
+func (tm *TestingGatedMicroBatcherProcess[I]) Process(jobs []*types.Job[I, string]) []*types.JobResult[I, string] {
+	select {
+	case tm.started <- struct{}{}:
+	default:
+	}
+	<-tm.release
+
+	results := make([]*types.JobResult[I, string], 0, len(jobs))
+	for _, job := range jobs {
+		if job.Data != "drop" {
+			results = append(results, &types.JobResult[I, string]{ID: job.ID, Data: job.Data})
+		}
+	}
+	return results
+}
+
+func TestMicroBatcherStatus(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 2, time.Hour)
+	fakeClock := clock.NewFake(time.Now())
+	cfg.SetClock(fakeClock)
+	processor := &TestingGatedMicroBatcherProcess[string]{started: make(chan struct{}, 1), release: make(chan struct{})}
+	mb := NewMicroBatcher("tester", processor, cfg)
+	assert.Nil(t, mb.Start())
+
+	expectStatus := func(id string, expected types.JobStatus) *types.JobResult[string, string] {
+		status, ok := mb.Status(id)
+		if assert.True(t, ok, id) {
+			assert.Equal(t, expected, status.Status, id)
+		}
+		return status
+	}
+
+	_, err := mb.SubmitAt(&types.Job[string, string]{ID: "delayed"}, fakeClock.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	expectStatus("delayed", types.JobStatusAccepted)
+
+	// the full batch is dispatched and blocks in the processor
+	for _, job := range []*types.Job[string, string]{{ID: "kept", Data: "kept"}, {ID: "dropped", Data: "drop"}} {
+		_, err = mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	<-processor.started
+	status := expectStatus("kept", types.JobStatusProcessing)
+	assert.Equal(t, 1, status.BatchSequence)
+	assert.Equal(t, fakeClock.Now(), status.StartedAt)
+
+	_, err = mb.Submit(&types.Job[string, string]{ID: "queued", Data: "queued"})
+	assert.Nil(t, err)
+	expectStatus("queued", types.JobStatusQueued)
+
+	close(processor.release)
+	assert.Nil(t, mb.Flush(context.Background()))
+	status = expectStatus("kept", types.JobStatusSucceeded)
+	assert.Equal(t, "kept", status.Data)
+	assert.Equal(t, fakeClock.Now(), status.SubmittedAt)
+	expectStatus("dropped", types.JobStatusDropped)
+	expectStatus("queued", types.JobStatusSucceeded)
+
+	// jobs which are taken out of the batcher or never submitted are unknown
+	assert.Len(t, mb.TakeDelayed(), 1)
+	_, ok := mb.Status("delayed")
+	assert.False(t, ok)
+	_, ok = mb.Status("unknown")
+	assert.False(t, ok)
+	assert.Nil(t, mb.Shutdown())
+}
+
+func TestMicroBatcherStatusRetention(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	assert.Nil(t, cfg.SetStatusRetention(2, time.Minute))
+	fakeClock := clock.NewFake(time.Now())
+	cfg.SetClock(fakeClock)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+	assert.Nil(t, mb.Start())
+
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mb.Flush(context.Background()))
+
+	// the oldest finished job is pushed out by the max number of jobs
+	_, ok := mb.Status("job1")
+	assert.False(t, ok)
+	for _, id := range []string{"job2", "job3"} {
+		status, ok := mb.Status(id)
+		assert.True(t, ok)
+		assert.Equal(t, types.JobStatusSucceeded, status.Status)
+	}
+
+	// the other finished jobs are forgotten after the TTL
+	fakeClock.Advance(time.Minute)
+	for _, id := range []string{"job2", "job3"} {
+		_, ok = mb.Status(id)
+		assert.False(t, ok, id)
+	}
+	assert.Nil(t, mb.Shutdown())
+}
+
+type TestingNilResultMicroBatcherProcess[I types.JobId] struct{}
+
+// Process returns a nil result for every job.
+func (tm *TestingNilResultMicroBatcherProcess[I]) Process(jobs []*types.Job[I, string]) []*types.JobResult[I, string] {
+	return make([]*types.JobResult[I, string], len(jobs))
+}
+
+func TestMicroBatcherNilResults(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	mb := NewMicroBatcher("tester", &TestingNilResultMicroBatcherProcess[string]{}, cfg)
+	assert.Nil(t, mb.Start())
+
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Nil(t, mb.Shutdown())
+
+	// nil results are dropped jobs
+	assert.Empty(t, mb.GetCurrentResults())
+	for _, job := range jobs {
+		status, ok := mb.Status(job.ID)
+		assert.True(t, ok)
+		assert.Equal(t, types.JobStatusDropped, status.Status)
+	}
+}
+
+func TestMicroBatcherShutdownStopsRetries(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	assert.Nil(t, cfg.SetBatchRetries(3))
+	cfg.SetClock(clock.NewFake(time.Now()))
+	processor := &TestingBatchResultMicroBatcherProcess[int]{}
+	processor.throttles.Store(3)
+	mb := NewMicroBatcher("tester", processor, cfg)
+	assert.Nil(t, mb.Start())
+
+	_, err := mb.Submit(&types.Job[int, string]{ID: 1, Data: "a"})
+	assert.Nil(t, err)
+	go func() {
+		_ = mb.Flush(context.Background())
+	}()
+	assert.Eventually(t, func() bool {
+		return processor.calls.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	// the fake time never passes the retry hint, so the shutdown must not wait for it
+	assert.Nil(t, mb.Shutdown())
+	assert.Equal(t, int32(1), processor.calls.Load())
+	results := mb.GetCurrentResults()
+	assert.Len(t, results, 1)
+	assert.EqualError(t, results[0].Errors, "throttled")
+}
+
+type TestingNilBatchResultMicroBatcherProcess[I types.JobId] struct {
+	TestingMicroBatcherProcess[I]
+}
+
+// ProcessBatch returns no batch result at all.
+func (tm *TestingNilBatchResultMicroBatcherProcess[I]) ProcessBatch(
+	ctx context.Context,
+	jobs []*types.Job[I, string],
+) *types.BatchResult[I, string] {
+	return nil
+}
+
+func TestMicroBatcherNilBatchResult(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	mb := NewMicroBatcher("tester", &TestingNilBatchResultMicroBatcherProcess[string]{}, cfg)
+	assert.Nil(t, mb.Start())
+
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Nil(t, mb.Shutdown())
+
+	// a nil batch result has no results, so its jobs are dropped
+	assert.Empty(t, mb.GetCurrentResults())
+	for _, job := range jobs {
+		status, ok := mb.Status(job.ID)
+		assert.True(t, ok)
+		assert.Equal(t, types.JobStatusDropped, status.Status)
+	}
+}
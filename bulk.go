@@ -0,0 +1,253 @@
+package microbatcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"microbatcher/pkg/ratelimit"
+	"microbatcher/pkg/types"
+	"slices"
+)
+
+// SubmitMode decides how SubmitMany handles the jobs of a submission when some of them cannot be admitted.
+type SubmitMode int
+
+const (
+	// SubmitBestEffort queues every job which can be admitted and rejects the others.
+	SubmitBestEffort SubmitMode = iota
+	// SubmitAllOrNothing queues the jobs only if every one of them can be admitted, and rejects all of them
+	// otherwise.
+	SubmitAllOrNothing
+)
+
+func (sm SubmitMode) String() string {
+	switch sm {
+	case SubmitBestEffort:
+		return "best-effort"
+	case SubmitAllOrNothing:
+		return "all-or-nothing"
+	default:
+		return "unknown"
+	}
+}
+
+// Admission is the outcome of one job of SubmitMany. An accepted job has the result responding to its submission,
+// like Submit returns it, while a rejected job has the reason of its rejection.
+type Admission[I types.JobId, T any] struct {
+	ID     I
+	Result *types.JobResult[I, T]
+	Err    error
+}
+
+// Accepted reports whether the job is accepted.
+func (a Admission[I, T]) Accepted() bool {
+	return a.Err == nil
+}
+
+// SubmitMany submits the jobs in one go, which admits them under one lock of the job queue, and returns the
+// admission of every job in order of the jobs. Jobs are rejected for the same reasons as by Submit, and for
+// ErrDuplicateJob when their ID occurs twice in the jobs.
+//
+// In best-effort mode the jobs which can be admitted are queued regardless of the others. In all-or-nothing mode
+// either every job is queued, or no job is. The rejected jobs then get their own reason and the other jobs get
+// ErrSubmissionRejected, and SubmitMany returns the reason of the first rejected job. Rate limit tokens are only
+// kept for the jobs which are queued.
+func (mb *microBatcher[I, T]) SubmitMany(jobs []*types.Job[I, T], mode SubmitMode) ([]Admission[I, T], error) {
+	admissions := make([]Admission[I, T], len(jobs))
+	seen := make(map[I]bool, len(jobs))
+	var pending []int
+	for i, job := range jobs {
+		admissions[i].ID = job.ID
+		if seen[job.ID] {
+			admissions[i].Err = ErrDuplicateJob
+			continue
+		}
+		seen[job.ID] = true
+
+		result, known, err := mb.reserveKey(job)
+		switch {
+		case err != nil:
+			admissions[i].Err = err
+		case known:
+			admissions[i].Result = result
+		default:
+			pending = append(pending, i)
+		}
+	}
+	if mode == SubmitAllOrNothing && rejected(admissions) {
+		return mb.rejectAll(jobs, admissions, pending)
+	}
+
+	// reject before the rate limit charges tokens, or even waits for them. In all-or-nothing mode the queue must
+	// take every job. The jobs are checked again once they are queued, since the queue may fill up in the meantime.
+	capacity := 0
+	if mode == SubmitAllOrNothing {
+		capacity = len(pending)
+	}
+	if err := mb.admissible(capacity); err != nil {
+		for _, i := range pending {
+			admissions[i].Err = err
+		}
+		if mode == SubmitAllOrNothing {
+			return mb.rejectAll(jobs, admissions, pending)
+		}
+		for _, i := range pending {
+			mb.releaseKey(jobs[i])
+		}
+		return admissions, nil
+	}
+
+	admitted := mb.admitMany(len(pending), mode)
+	for _, i := range pending[admitted:] {
+		admissions[i].Err = ErrRateLimited
+	}
+	if mode == SubmitAllOrNothing && rejected(admissions) {
+		return mb.rejectAll(jobs, admissions, pending)
+	}
+	for _, i := range pending[admitted:] {
+		mb.releaseKey(jobs[i])
+	}
+	pending = pending[:admitted]
+
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	queueJobs := make([]*types.Job[I, T], 0, len(pending))
+	// the statuses which the tracked jobs replace by index, which are restored when the jobs are rejected after all
+	previous := make(map[int]*types.JobResult[I, T], len(pending))
+	for _, i := range pending {
+		if !mb.running {
+			admissions[i].Err = ErrNotStarted
+			continue
+		}
+		// the jobs are tracked before they are queued, since the execute loop may take them straight away
+		admissions[i].Result = mb.submittedResult(jobs[i].ID, types.JobStatusQueued)
+		previous[i] = mb.tracker.submit(admissions[i].Result)
+		queueJobs = append(queueJobs, jobs[i])
+	}
+
+	queued := mb.offer(queueJobs, mode)
+	mb.rateLimits.submit.Return(len(pending) - queued)
+	for _, i := range pending[queued:] {
+		if admissions[i].Err == nil {
+			admissions[i].Result = nil
+			admissions[i].Err = ErrQueueFull
+		}
+	}
+	// the statuses are restored in reverse order of submission, in case a job ID is submitted twice
+	if mode == SubmitAllOrNothing && rejected(admissions) {
+		for _, i := range slices.Backward(pending) {
+			if status, ok := previous[i]; ok {
+				mb.tracker.restore(jobs[i].ID, status)
+			}
+		}
+		return mb.rejectAll(jobs, admissions, pending)
+	}
+	for _, i := range slices.Backward(pending[queued:]) {
+		if status, ok := previous[i]; ok {
+			mb.tracker.restore(jobs[i].ID, status)
+		}
+		mb.releaseKey(jobs[i])
+	}
+
+	slog.Info(fmt.Sprintf("%s submits %d of %d jobs", mb.name, queued, len(jobs)))
+	return admissions, nil
+}
+
+// rejectAll rejects the jobs of an all-or-nothing submission. The idempotency keys of the pending jobs are
+// released, and the jobs which are not rejected for their own reason get ErrSubmissionRejected.
+func (mb *microBatcher[I, T]) rejectAll(
+	jobs []*types.Job[I, T],
+	admissions []Admission[I, T],
+	pending []int,
+) ([]Admission[I, T], error) {
+	for _, i := range pending {
+		mb.releaseKey(jobs[i])
+	}
+
+	var firstErr error
+	for i := range admissions {
+		if admissions[i].Err != nil && firstErr == nil {
+			firstErr = admissions[i].Err
+		}
+	}
+	for i := range admissions {
+		admissions[i].Result = nil
+		if admissions[i].Err == nil {
+			admissions[i].Err = ErrSubmissionRejected
+		}
+	}
+	slog.Warn(fmt.Sprintf("%s rejects submission of %d jobs: %s", mb.name, len(jobs), firstErr))
+	return admissions, firstErr
+}
+
+// admitMany applies the submission rate limit to n jobs according to the rate limit policy, and returns how many
+// of them are admitted. In all-or-nothing mode, either all of them or none are admitted.
+func (mb *microBatcher[I, T]) admitMany(n int, mode SubmitMode) int {
+	if mb.rateLimits.policy != ratelimit.PolicyReject {
+		if err := mb.rateLimits.submit.Wait(context.Background(), n); err != nil {
+			return 0
+		}
+		return n
+	}
+
+	if mode == SubmitAllOrNothing {
+		if !mb.rateLimits.submit.Allow(n) {
+			return 0
+		}
+		return n
+	}
+
+	admitted := 0
+	for admitted < n && mb.rateLimits.submit.Allow(1) {
+		admitted++
+	}
+	return admitted
+}
+
+// admissible returns the reason why n jobs cannot be queued right now, if they cannot.
+func (mb *microBatcher[I, T]) admissible(n int) error {
+	mb.runningMutex.Lock()
+	defer mb.runningMutex.Unlock()
+
+	if !mb.running {
+		return ErrNotStarted
+	}
+
+	mb.queueMutex.Lock()
+	defer mb.queueMutex.Unlock()
+
+	if cap(mb.jobs)-len(mb.jobs) < n {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// offer puts the jobs into the job queue as far as it has capacity, and returns how many are queued. In
+// all-or-nothing mode, either all of them or none are queued. Every sender of the job queue offers jobs under the
+// queue mutex, so that the capacity cannot be taken by others in between, and the sends never block.
+func (mb *microBatcher[I, T]) offer(jobs []*types.Job[I, T], mode SubmitMode) int {
+	mb.queueMutex.Lock()
+	defer mb.queueMutex.Unlock()
+
+	capacity := cap(mb.jobs) - len(mb.jobs)
+	if mode == SubmitAllOrNothing && capacity < len(jobs) {
+		return 0
+	}
+
+	queued := min(capacity, len(jobs))
+	for _, job := range jobs[:queued] {
+		mb.jobs <- job
+	}
+	return queued
+}
+
+// rejected reports whether any of the jobs is rejected.
+func rejected[I types.JobId, T any](admissions []Admission[I, T]) bool {
+	for _, admission := range admissions {
+		if admission.Err != nil {
+			return true
+		}
+	}
+	return false
+}
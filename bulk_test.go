@@ -0,0 +1,274 @@
+package microbatcher
+
+import (
+	"context"
+	"fmt"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/configs"
+	"microbatcher/pkg/idempotency"
+	"microbatcher/pkg/ratelimit"
+	"microbatcher/pkg/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMicroBatcherSubmitMany(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           SubmitMode
+		ids            []string
+		submitLimit    ratelimit.Limit
+		notStarted     bool
+		expectedErrors []error
+		expectedErr    error
+		expectedQueued int
+	}{
+		{
+			name:           "Best effort queues the jobs up to the queue capacity",
+			mode:           SubmitBestEffort,
+			ids:            []string{"a", "b", "c", "d", "e", "f"},
+			expectedErrors: []error{nil, nil, nil, nil, ErrQueueFull, ErrQueueFull},
+			expectedQueued: 4,
+		},
+		{
+			name: "All or nothing rejects every job beyond the queue capacity",
+			mode: SubmitAllOrNothing,
+			ids:  []string{"a", "b", "c", "d", "e", "f"},
+			expectedErrors: []error{
+				ErrQueueFull, ErrQueueFull, ErrQueueFull, ErrQueueFull, ErrQueueFull, ErrQueueFull,
+			},
+			expectedErr: ErrQueueFull,
+		},
+		{
+			name:           "All or nothing queues the jobs within the queue capacity",
+			mode:           SubmitAllOrNothing,
+			ids:            []string{"a", "b", "c", "d"},
+			expectedErrors: []error{nil, nil, nil, nil},
+			expectedQueued: 4,
+		},
+		{
+			name:           "Best effort rejects duplicated jobs",
+			mode:           SubmitBestEffort,
+			ids:            []string{"a", "b", "a"},
+			expectedErrors: []error{nil, nil, ErrDuplicateJob},
+			expectedQueued: 2,
+		},
+		{
+			name:           "All or nothing rejects every job for a duplicated job",
+			mode:           SubmitAllOrNothing,
+			ids:            []string{"a", "b", "a"},
+			expectedErrors: []error{ErrSubmissionRejected, ErrSubmissionRejected, ErrDuplicateJob},
+			expectedErr:    ErrDuplicateJob,
+		},
+		{
+			name:           "Best effort admits the jobs up to the rate limit",
+			mode:           SubmitBestEffort,
+			ids:            []string{"a", "b", "c"},
+			submitLimit:    ratelimit.Limit{Rate: 1, Burst: 2},
+			expectedErrors: []error{nil, nil, ErrRateLimited},
+			expectedQueued: 2,
+		},
+		{
+			name:           "All or nothing rejects every job beyond the rate limit",
+			mode:           SubmitAllOrNothing,
+			ids:            []string{"a", "b", "c"},
+			submitLimit:    ratelimit.Limit{Rate: 1, Burst: 2},
+			expectedErrors: []error{ErrRateLimited, ErrRateLimited, ErrRateLimited},
+			expectedErr:    ErrRateLimited,
+		},
+		{
+			name:           "Jobs are rejected when the batcher is not started",
+			mode:           SubmitBestEffort,
+			ids:            []string{"a", "b"},
+			notStarted:     true,
+			expectedErrors: []error{ErrNotStarted, ErrNotStarted},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := configs.NewCustomConfig(4, 2, time.Hour)
+			cfg.SetClock(clock.NewFake(time.Now()))
+			rateLimitConfig, _ := ratelimit.NewCustomConfig(
+				ratelimit.Limit{}, ratelimit.Limit{}, ratelimit.Limit{}, ratelimit.PolicyReject,
+			)
+			cfg.SetRateLimit(rateLimitConfig)
+			processor := &TestingGatedMicroBatcherProcess[string]{started: make(chan struct{}, 1), release: make(chan struct{})}
+			mb := NewMicroBatcher("tester", processor, cfg)
+			if tt.notStarted {
+				close(processor.release)
+			} else {
+				assert.Nil(t, mb.Start())
+				// the first batch blocks the execute loop, so that the job queue keeps the submitted jobs
+				for i := 0; i < 2; i++ {
+					_, err := mb.Submit(&types.Job[string, string]{ID: fmt.Sprintf("blocking%d", i)})
+					assert.Nil(t, err)
+				}
+				<-processor.started
+				mb.SetSubmitRateLimit(tt.submitLimit)
+			}
+
+			jobs := make([]*types.Job[string, string], 0, len(tt.ids))
+			for _, id := range tt.ids {
+				jobs = append(jobs, &types.Job[string, string]{ID: id, Data: id})
+			}
+			admissions, err := mb.SubmitMany(jobs, tt.mode)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Len(t, admissions, len(tt.ids))
+			for i, admission := range admissions {
+				assert.Equal(t, tt.ids[i], admission.ID)
+				assert.Equal(t, tt.expectedErrors[i], admission.Err, admission.ID)
+				assert.Equal(t, tt.expectedErrors[i] == nil, admission.Accepted())
+				if admission.Accepted() {
+					assert.Equal(t, types.JobStatusQueued, admission.Result.Status)
+				} else {
+					assert.Nil(t, admission.Result)
+				}
+			}
+			assert.Equal(t, tt.expectedQueued, mb.queueDepth())
+
+			if !tt.notStarted {
+				// rejected jobs are not tracked
+				for i, id := range tt.ids {
+					status, ok := mb.Status(id)
+					if tt.expectedErrors[i] == nil {
+						assert.True(t, ok)
+						assert.Equal(t, types.JobStatusQueued, status.Status)
+					} else if tt.expectedErrors[i] != ErrDuplicateJob {
+						assert.False(t, ok, id)
+					}
+				}
+
+				close(processor.release)
+				assert.Nil(t, mb.Flush(context.Background()))
+				assert.Nil(t, mb.Shutdown())
+				assert.Len(t, mb.GetCurrentResults(), 2+tt.expectedQueued)
+			}
+		})
+	}
+}
+
+func TestMicroBatcherSubmitManyReturnsTokens(t *testing.T) {
+	tests := []struct {
+		name            string
+		mode            SubmitMode
+		ids             []string
+		expectedQueued  int
+		expectedReturns int
+	}{
+		{
+			name:            "All or nothing does not charge tokens for a full queue",
+			mode:            SubmitAllOrNothing,
+			ids:             []string{"a", "b", "c", "d", "e", "f"},
+			expectedReturns: 6,
+		},
+		{
+			name:            "Best effort returns the tokens of jobs beyond the queue capacity",
+			mode:            SubmitBestEffort,
+			ids:             []string{"a", "b", "c", "d", "e", "f"},
+			expectedQueued:  4,
+			expectedReturns: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := configs.NewCustomConfig(4, 2, time.Hour)
+			cfg.SetClock(clock.NewFake(time.Now()))
+			processor := &TestingGatedMicroBatcherProcess[string]{started: make(chan struct{}, 1), release: make(chan struct{})}
+			mb := NewMicroBatcher("tester", processor, cfg)
+			assert.Nil(t, mb.Start())
+			// the first batch blocks the execute loop, so that the job queue keeps the submitted jobs
+			for i := 0; i < 2; i++ {
+				_, err := mb.Submit(&types.Job[string, string]{ID: fmt.Sprintf("blocking%d", i)})
+				assert.Nil(t, err)
+			}
+			<-processor.started
+			mb.SetSubmitRateLimit(ratelimit.Limit{Rate: 1, Burst: len(tt.ids)})
+
+			jobs := make([]*types.Job[string, string], 0, len(tt.ids))
+			for _, id := range tt.ids {
+				jobs = append(jobs, &types.Job[string, string]{ID: id, Data: id})
+			}
+			_, _ = mb.SubmitMany(jobs, tt.mode)
+			assert.Equal(t, tt.expectedQueued, mb.queueDepth())
+
+			// the fake time does not refill the bucket, so only the returned tokens are left
+			assert.True(t, mb.rateLimits.submit.Allow(tt.expectedReturns))
+			assert.False(t, mb.rateLimits.submit.Allow(1))
+
+			close(processor.release)
+			assert.Nil(t, mb.Shutdown())
+		})
+	}
+}
+
+func TestMicroBatcherSubmitManyKeepsFinishedStatus(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(4, 2, time.Hour)
+	cfg.SetClock(clock.NewFake(time.Now()))
+	processor := &TestingGatedMicroBatcherProcess[string]{started: make(chan struct{}, 1), release: make(chan struct{})}
+	mb := NewMicroBatcher("tester", processor, cfg)
+	assert.Nil(t, mb.Start())
+
+	_, err := mb.Submit(&types.Job[string, string]{ID: "f", Data: "f"})
+	assert.Nil(t, err)
+	go func() {
+		processor.release <- struct{}{}
+	}()
+	assert.Nil(t, mb.Flush(context.Background()))
+	<-processor.started
+
+	// the first batch blocks the execute loop, so that the job queue keeps the submitted jobs
+	for i := 0; i < 2; i++ {
+		_, err := mb.Submit(&types.Job[string, string]{ID: fmt.Sprintf("blocking%d", i)})
+		assert.Nil(t, err)
+	}
+	<-processor.started
+
+	jobs := make([]*types.Job[string, string], 0, 6)
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		jobs = append(jobs, &types.Job[string, string]{ID: id, Data: id})
+	}
+	admissions, err := mb.SubmitMany(jobs, SubmitBestEffort)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrQueueFull, admissions[5].Err)
+
+	// the rejected resubmission keeps the status of the finished job
+	status, ok := mb.Status("f")
+	assert.True(t, ok)
+	assert.Equal(t, types.JobStatusSucceeded, status.Status)
+
+	close(processor.release)
+	assert.Nil(t, mb.Shutdown())
+}
+
+func TestMicroBatcherSubmitManyIdempotency(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, time.Hour)
+	mb := NewMicroBatcher("tester", &TestingMicroBatcherProcess[string]{}, cfg)
+	store, _ := idempotency.NewMemoryStore[string, string](time.Minute)
+	assert.Nil(t, mb.SetIdempotencyStore(store))
+	assert.Nil(t, mb.Start())
+
+	_, err := mb.Submit(jobs[0])
+	assert.Nil(t, err)
+
+	// a resubmitted job is accepted without being queued again, and a rejected submission releases its keys
+	admissions, err := mb.SubmitMany(
+		[]*types.Job[string, string]{jobs[0], jobs[1], jobs[1]},
+		SubmitAllOrNothing,
+	)
+	assert.ErrorIs(t, err, ErrDuplicateJob)
+	assert.False(t, admissions[0].Accepted())
+
+	admissions, err = mb.SubmitMany(jobs, SubmitAllOrNothing)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStatusAccepted, admissions[0].Result.Status)
+	for _, admission := range admissions[1:] {
+		assert.Equal(t, types.JobStatusQueued, admission.Result.Status)
+	}
+
+	assert.Nil(t, mb.Shutdown())
+	assert.Len(t, mb.GetCurrentResults(), len(jobs))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"microbatcher/pkg/configs"
+	"os"
+	"time"
+)
+
+// fileConfig is the batching config file, e.g.
+//
+//	{"queue_size": 100, "batch_size": 10, "batch_frequency": "100ms", "batch_timeout": "5s"}
+//
+// Missing values fall back to the default config.
+type fileConfig struct {
+	QueueSize      int    `json:"queue_size"`
+	BatchSize      int    `json:"batch_size"`
+	BatchFrequency string `json:"batch_frequency"`
+	BatchTimeout   string `json:"batch_timeout"`
+}
+
+// loadConfig reads the batcher config from the file, or returns the default config when path is empty.
+func loadConfig(path string) (configs.BatcherConfig, error) {
+	defaults := configs.NewDefaultConfig()
+	if path == "" {
+		return defaults, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return configs.BatcherConfig{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var decoded fileConfig
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return configs.BatcherConfig{}, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return decoded.toBatcherConfig(defaults)
+}
+
+func (fc fileConfig) toBatcherConfig(defaults configs.BatcherConfig) (configs.BatcherConfig, error) {
+	queueSize := defaults.GetJobQueueSize()
+	if fc.QueueSize != 0 {
+		queueSize = fc.QueueSize
+	}
+	batchSize := defaults.GetBatchProcessSize()
+	if fc.BatchSize != 0 {
+		batchSize = fc.BatchSize
+	}
+	batchFrequency := defaults.GetBatchProcessFrequency()
+	if fc.BatchFrequency != "" {
+		parsed, err := time.ParseDuration(fc.BatchFrequency)
+		if err != nil {
+			return configs.BatcherConfig{}, fmt.Errorf("invalid batch_frequency: %w", err)
+		}
+		batchFrequency = parsed
+	}
+
+	config, err := configs.NewCustomConfig(queueSize, batchSize, batchFrequency)
+	if err != nil {
+		return configs.BatcherConfig{}, err
+	}
+
+	if fc.BatchTimeout != "" {
+		batchTimeout, err := time.ParseDuration(fc.BatchTimeout)
+		if err != nil {
+			return configs.BatcherConfig{}, fmt.Errorf("invalid batch_timeout: %w", err)
+		}
+		if err := config.SetBatchTimeout(batchTimeout); err != nil {
+			return configs.BatcherConfig{}, err
+		}
+	}
+	return config, nil
+}
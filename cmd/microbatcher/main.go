@@ -0,0 +1,297 @@
+// Command microbatcher replays JSONL job files through a batcher and writes the results as JSONL.
+//
+// Every input line is a job of the form {"id": ..., "data": ...}, where the ID is a JSON string or number and may be
+// read from another field by -id-field. A line without ID gets the ID of its position, e.g. "jobs.jsonl:3" or "-:3"
+// for stdin. Jobs are read from the given files, or from stdin when no file or "-" is given, and processed by one
+// of the built-in processors:
+//
+//	echo   returns the data of every job as its result
+//	exec   runs a command per batch with the batch as JSON array on stdin and the results on stdout, or with
+//	       -keep-alive one command for all batches with one JSON array per line in both directions
+//	http   posts every batch as JSON array to a URL and reads the results from the response
+//
+// Results are written as {"id": ..., "data": ..., "error": ...} lines.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"microbatcher"
+	"microbatcher/pkg/processor"
+	"microbatcher/pkg/ratelimit"
+	"microbatcher/pkg/types"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const SUBMIT_RETRY_INTERVAL_IN_MILLISECOND = 10
+const MAX_LINE_BYTES = 10 << 20
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	configPath  string
+	processor   string
+	command     string
+	keepAlive   bool
+	url         string
+	rate        float64
+	concurrency int
+	output      string
+	idField     string
+	inputs      []string
+}
+
+func parseOptions(args []string) (options, error) {
+	var opts options
+	flags := flag.NewFlagSet("microbatcher", flag.ContinueOnError)
+	flags.StringVar(&opts.configPath, "config", "", "path of the JSON batching config file")
+	flags.StringVar(&opts.processor, "processor", "echo", "processor of the batches: echo, exec or http")
+	flags.StringVar(&opts.command, "exec", "", "command run by the exec processor")
+	flags.BoolVar(&opts.keepAlive, "keep-alive", false, "keep the command of the exec processor alive between batches")
+	flags.StringVar(&opts.url, "url", "", "URL the http processor posts to")
+	flags.Float64Var(&opts.rate, "rate", 0, "submitted jobs per second, 0 is unlimited")
+	flags.IntVar(&opts.concurrency, "concurrency", 1, "number of concurrent submitters")
+	flags.StringVar(&opts.output, "output", "", "path of the JSONL results file, stdout when empty")
+	flags.StringVar(&opts.idField, "id-field", "id", "field of the job ID in the input lines")
+	if err := flags.Parse(args); err != nil {
+		return options{}, err
+	}
+
+	if opts.concurrency < 1 {
+		return options{}, errors.New("concurrency must be positive")
+	}
+	if opts.rate < 0 {
+		return options{}, errors.New("rate must not be negative")
+	}
+	opts.inputs = flags.Args()
+	if len(opts.inputs) == 0 {
+		opts.inputs = []string{"-"}
+	}
+	return opts, nil
+}
+
+func newProcessor(opts options) (processor.BatchProcessor[string, json.RawMessage], error) {
+	switch opts.processor {
+	case "echo":
+		return echoProcessor{}, nil
+	case "exec":
+		command := strings.Fields(opts.command)
+		if len(command) == 0 {
+			return nil, errors.New("exec processor requires -exec")
+		}
+		return processor.NewSubprocessProcessor[string, json.RawMessage]("exec", command, opts.keepAlive, 0)
+	case "http":
+		if opts.url == "" {
+			return nil, errors.New("http processor requires -url")
+		}
+		return processor.NewHTTPProcessor[string, json.RawMessage]("http", opts.url)
+	default:
+		return nil, fmt.Errorf("unknown processor %s", opts.processor)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	opts, err := parseOptions(args)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConfig(opts.configPath)
+	if err != nil {
+		return err
+	}
+	if opts.rate > 0 {
+		rateLimit, rateErr := ratelimit.NewCustomConfig(
+			ratelimit.Limit{}, ratelimit.Limit{}, ratelimit.Limit{Rate: opts.rate, Burst: 1}, ratelimit.PolicyWait,
+		)
+		if rateErr != nil {
+			return rateErr
+		}
+		config.SetRateLimit(rateLimit)
+	}
+
+	batchProcessor, err := newProcessor(opts)
+	if err != nil {
+		return err
+	}
+
+	output := stdout
+	if opts.output != "" {
+		file, createErr := os.Create(opts.output)
+		if createErr != nil {
+			return fmt.Errorf("failed to create output: %w", createErr)
+		}
+		defer file.Close()
+		output = file
+	}
+	writer := newResultWriter(output)
+
+	batcher := microbatcher.NewMicroBatcher("microbatcher", batchProcessor, config)
+	batcher.Subscribe(writer.write)
+	if err := batcher.Start(); err != nil {
+		return err
+	}
+
+	jobs := make(chan *types.Job[string, json.RawMessage])
+	var submitted, rejected atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if submitErr := submit(batcher, job); submitErr != nil {
+					slog.Error(fmt.Sprintf("failed to submit %s: %s", job, submitErr))
+					rejected.Add(1)
+					continue
+				}
+				submitted.Add(1)
+			}
+		}()
+	}
+
+	readErr := readInputs(opts.inputs, opts.idField, stdin, jobs)
+	close(jobs)
+	wg.Wait()
+
+	shutdownErr := batcher.Shutdown()
+	if closer, ok := batchProcessor.(io.Closer); ok {
+		shutdownErr = errors.Join(shutdownErr, closer.Close())
+	}
+	slog.Info(fmt.Sprintf("submitted %d jobs, rejected %d jobs", submitted.Load(), rejected.Load()))
+	return errors.Join(readErr, shutdownErr, writer.flush())
+}
+
+// submit submits the job and retries as long as the job queue is full.
+func submit(batcher microbatcher.Batcher[string, json.RawMessage], job *types.Job[string, json.RawMessage]) error {
+	for {
+		_, err := batcher.Submit(job)
+		if !errors.Is(err, microbatcher.ErrQueueFull) {
+			return err
+		}
+		time.Sleep(SUBMIT_RETRY_INTERVAL_IN_MILLISECOND * time.Millisecond)
+	}
+}
+
+// readInputs decodes the jobs of every input, where "-" is stdin, and sends them to the jobs channel.
+func readInputs(
+	inputs []string,
+	idField string,
+	stdin io.Reader,
+	jobs chan<- *types.Job[string, json.RawMessage],
+) error {
+	for _, input := range inputs {
+		if input == "-" {
+			if err := readJobs(input, idField, stdin, jobs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("failed to open input: %w", err)
+		}
+		err = readJobs(input, idField, file, jobs)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJobs(name string, idField string, reader io.Reader, jobs chan<- *types.Job[string, json.RawMessage]) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, MAX_LINE_BYTES)
+	for line := 1; scanner.Scan(); line++ {
+		content := strings.TrimSpace(scanner.Text())
+		if content == "" {
+			continue
+		}
+
+		position := fmt.Sprintf("%s:%d", name, line)
+		job, err := decodeJob([]byte(content), idField, position)
+		if err != nil {
+			return fmt.Errorf("%s: %w", position, err)
+		}
+		jobs <- job
+	}
+	return scanner.Err()
+}
+
+// decodeJob decodes a JSONL job. The ID is read from the ID field and may be a JSON string or number, which is
+// kept in its text form. A job without ID gets its position as ID.
+func decodeJob(content []byte, idField string, position string) (*types.Job[string, json.RawMessage], error) {
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return nil, err
+	}
+
+	rawID, ok := decoded[idField]
+	if !ok || string(rawID) == "null" {
+		return &types.Job[string, json.RawMessage]{ID: position, Data: decoded["data"]}, nil
+	}
+
+	id := string(rawID)
+	if strings.HasPrefix(id, `"`) {
+		if err := json.Unmarshal(rawID, &id); err != nil {
+			return nil, err
+		}
+	}
+	return &types.Job[string, json.RawMessage]{ID: id, Data: decoded["data"]}, nil
+}
+
+// resultWriter writes results as JSONL. It is a subscriber of the batcher.
+type resultWriter struct {
+	mutex   sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	err     error
+}
+
+func newResultWriter(output io.Writer) *resultWriter {
+	writer := bufio.NewWriter(output)
+	return &resultWriter{writer: writer, encoder: json.NewEncoder(writer)}
+}
+
+func (rw *resultWriter) write(results []*types.JobResult[string, json.RawMessage]) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	for _, result := range results {
+		encoded := record{ID: result.ID, Data: result.Data}
+		if result.Errors != nil {
+			encoded.Error = result.Errors.Error()
+		}
+		if err := rw.encoder.Encode(encoded); err != nil && rw.err == nil {
+			rw.err = fmt.Errorf("failed to write result: %w", err)
+		}
+	}
+}
+
+func (rw *resultWriter) flush() error {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if err := rw.writer.Flush(); err != nil && rw.err == nil {
+		rw.err = fmt.Errorf("failed to write results: %w", err)
+	}
+	return rw.err
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const inputJobs = `{"id": 1, "data": {"n": 1}}
+{"id": "two", "data": "second"}
+
+{"id": 3, "data": [3]}
+`
+
+func sortedLines(output string) []string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestRun(t *testing.T) {
+	echoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer echoServer.Close()
+
+	tests := []struct {
+		name          string
+		args          []string
+		expectedLines []string
+	}{
+		{
+			name: "Echo processor with concurrency and rate",
+			args: []string{"-concurrency", "2", "-rate", "1000"},
+			expectedLines: []string{
+				`{"id":"1","data":{"n":1}}`,
+				`{"id":"3","data":[3]}`,
+				`{"id":"two","data":"second"}`,
+			},
+		},
+		{
+			name: "Exec processor",
+			args: []string{"-processor", "exec", "-exec", "cat"},
+			expectedLines: []string{
+				`{"id":"1","data":{"n":1}}`,
+				`{"id":"3","data":[3]}`,
+				`{"id":"two","data":"second"}`,
+			},
+		},
+		{
+			name: "Exec processor kept alive",
+			args: []string{"-processor", "exec", "-exec", "cat", "-keep-alive"},
+			expectedLines: []string{
+				`{"id":"1","data":{"n":1}}`,
+				`{"id":"3","data":[3]}`,
+				`{"id":"two","data":"second"}`,
+			},
+		},
+		{
+			name: "Exec processor with malformed output",
+			args: []string{"-processor", "exec", "-exec", "echo oops"},
+			expectedLines: []string{
+				`{"id":"1","data":null,"error":"malformed subprocess output: invalid character 'o' looking for beginning of value"}`,
+				`{"id":"3","data":null,"error":"malformed subprocess output: invalid character 'o' looking for beginning of value"}`,
+				`{"id":"two","data":null,"error":"malformed subprocess output: invalid character 'o' looking for beginning of value"}`,
+			},
+		},
+		{
+			name: "HTTP processor",
+			args: []string{"-processor", "http", "-url", echoServer.URL},
+			expectedLines: []string{
+				`{"id":"1","data":{"n":1}}`,
+				`{"id":"3","data":[3]}`,
+				`{"id":"two","data":"second"}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			assert.Nil(t, run(tt.args, strings.NewReader(inputJobs), &stdout))
+			assert.Equal(t, tt.expectedLines, sortedLines(stdout.String()))
+		})
+	}
+}
+
+func TestRunJobIDs(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		input         string
+		expectedLines []string
+	}{
+		{
+			name:  "Jobs without id get their position as id",
+			input: "{\"data\": 1}\n\n{\"id\": null, \"data\": 3}\n{\"id\": 4, \"data\": 4}\n",
+			expectedLines: []string{
+				`{"id":"-:1","data":1}`,
+				`{"id":"-:3","data":3}`,
+				`{"id":"4","data":4}`,
+			},
+		},
+		{
+			name:  "Job ids are read from the id field",
+			args:  []string{"-id-field", "key"},
+			input: "{\"key\": \"a\", \"id\": 1, \"data\": 1}\n{\"id\": 2, \"data\": 2}\n",
+			expectedLines: []string{
+				`{"id":"-:2","data":2}`,
+				`{"id":"a","data":1}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			assert.Nil(t, run(tt.args, strings.NewReader(tt.input), &stdout))
+			assert.Equal(t, tt.expectedLines, sortedLines(stdout.String()))
+		})
+	}
+}
+
+func TestRunWithFiles(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	inputPath := filepath.Join(dir, "jobs.jsonl")
+	outputPath := filepath.Join(dir, "results.jsonl")
+	assert.Nil(t, os.WriteFile(configPath, []byte(`{"queue_size": 4, "batch_size": 2, "batch_frequency": "10ms"}`), 0o600))
+	assert.Nil(t, os.WriteFile(inputPath, []byte(inputJobs), 0o600))
+
+	start := time.Now()
+	assert.Nil(t, run([]string{"-config", configPath, "-output", outputPath, inputPath, "-"},
+		strings.NewReader(`{"id": 4, "data": null}`), io.Discard))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	output, err := os.ReadFile(outputPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`{"id":"1","data":{"n":1}}`,
+		`{"id":"3","data":[3]}`,
+		`{"id":"4","data":null}`,
+		`{"id":"two","data":"second"}`,
+	}, sortedLines(string(output)))
+}
+
+func TestRunError(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		input         string
+		expectedError string
+	}{
+		{
+			name:          "Unknown processor",
+			args:          []string{"-processor", "grpc"},
+			expectedError: "unknown processor grpc",
+		},
+		{
+			name:          "Exec processor without command",
+			args:          []string{"-processor", "exec"},
+			expectedError: "exec processor requires -exec",
+		},
+		{
+			name:          "Invalid concurrency",
+			args:          []string{"-concurrency", "0"},
+			expectedError: "concurrency must be positive",
+		},
+		{
+			name:          "Missing config file",
+			args:          []string{"-config", "missing.json"},
+			expectedError: "failed to read config: open missing.json: no such file or directory",
+		},
+		{
+			name:          "Malformed job",
+			input:         `{"id": 1, "data": 1}` + "\n" + `{"id": 2`,
+			expectedError: "-:2: unexpected end of JSON input",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(tt.args, strings.NewReader(tt.input), io.Discard)
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"microbatcher/pkg/types"
+)
+
+// record is the JSON form of jobs and results in the JSONL files.
+type record struct {
+	ID    string          `json:"id"`
+	Data  json.RawMessage `json:"data"`
+	Error string          `json:"error,omitempty"`
+}
+
+func toRecords(jobs []*types.Job[string, json.RawMessage]) []record {
+	records := make([]record, 0, len(jobs))
+	for _, job := range jobs {
+		records = append(records, record{ID: job.ID, Data: job.Data})
+	}
+	return records
+}
+
+// fromRecords maps the records returned by a processor to results. Jobs without record get an error, so that
+// every job of the batch ends up with a result.
+func fromRecords(jobs []*types.Job[string, json.RawMessage], records []record) []*types.JobResult[string, json.RawMessage] {
+	byId := make(map[string]record, len(records))
+	for _, r := range records {
+		byId[r.ID] = r
+	}
+
+	results := make([]*types.JobResult[string, json.RawMessage], 0, len(jobs))
+	for _, job := range jobs {
+		r, ok := byId[job.ID]
+		result := &types.JobResult[string, json.RawMessage]{ID: job.ID, Data: r.Data}
+		switch {
+		case !ok:
+			result.Errors = fmt.Errorf("no result for job %s", job.ID)
+		case r.Error != "":
+			result.Errors = fmt.Errorf("%s", r.Error)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// echoProcessor returns the data of every job as its result.
+type echoProcessor struct{}
+
+func (echoProcessor) Process(jobs []*types.Job[string, json.RawMessage]) []*types.JobResult[string, json.RawMessage] {
+	return fromRecords(jobs, toRecords(jobs))
+}
@@ -0,0 +1,120 @@
+package microbatcher
+
+import (
+	"container/heap"
+	"microbatcher/pkg/types"
+	"sync"
+	"time"
+)
+
+// delayedJob is a job which is not batched before its time. The sequence keeps jobs of the same time in order of
+// submission.
+type delayedJob[I types.JobId, T any] struct {
+	job       *types.Job[I, T]
+	notBefore time.Time
+	sequence  uint64
+}
+
+// delayHeap is a min-heap of delayed jobs by time, implementing heap.Interface.
+type delayHeap[I types.JobId, T any] []*delayedJob[I, T]
+
+func (dh delayHeap[I, T]) Len() int {
+	return len(dh)
+}
+
+func (dh delayHeap[I, T]) Less(a, b int) bool {
+	if dh[a].notBefore.Equal(dh[b].notBefore) {
+		return dh[a].sequence < dh[b].sequence
+	}
+	return dh[a].notBefore.Before(dh[b].notBefore)
+}
+
+func (dh delayHeap[I, T]) Swap(a, b int) {
+	dh[a], dh[b] = dh[b], dh[a]
+}
+
+func (dh *delayHeap[I, T]) Push(x any) {
+	*dh = append(*dh, x.(*delayedJob[I, T]))
+}
+
+func (dh *delayHeap[I, T]) Pop() any {
+	old := *dh
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*dh = old[:len(old)-1]
+	return last
+}
+
+// delayQueue holds the delayed jobs of a batcher. It outlives the runs of the batcher, so that delayed jobs are
+// kept over a shutdown. The changed channel nudges the scheduler once a job is pushed.
+type delayQueue[I types.JobId, T any] struct {
+	mutex        sync.Mutex
+	jobs         delayHeap[I, T]
+	nextSequence uint64
+	changed      chan struct{}
+}
+
+func newDelayQueue[I types.JobId, T any]() *delayQueue[I, T] {
+	return &delayQueue[I, T]{changed: make(chan struct{}, 1)}
+}
+
+func (dq *delayQueue[I, T]) push(job *types.Job[I, T], notBefore time.Time) {
+	dq.mutex.Lock()
+	heap.Push(&dq.jobs, &delayedJob[I, T]{job: job, notBefore: notBefore, sequence: dq.nextSequence})
+	dq.nextSequence++
+	dq.mutex.Unlock()
+
+	select {
+	case dq.changed <- struct{}{}:
+	default:
+	}
+}
+
+// pushBack returns a popped job to the queue at its former position.
+func (dq *delayQueue[I, T]) pushBack(delayed *delayedJob[I, T]) {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	heap.Push(&dq.jobs, delayed)
+}
+
+// next returns the time of the earliest job, or false when the queue is empty.
+func (dq *delayQueue[I, T]) next() (time.Time, bool) {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if len(dq.jobs) == 0 {
+		return time.Time{}, false
+	}
+	return dq.jobs[0].notBefore, true
+}
+
+// popDue removes and returns the earliest job when it is due at the given time.
+func (dq *delayQueue[I, T]) popDue(now time.Time) (*delayedJob[I, T], bool) {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if len(dq.jobs) == 0 || dq.jobs[0].notBefore.After(now) {
+		return nil, false
+	}
+	return heap.Pop(&dq.jobs).(*delayedJob[I, T]), true
+}
+
+// takeAll removes and returns all jobs in order of their time.
+func (dq *delayQueue[I, T]) takeAll() []*types.Job[I, T] {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	jobs := make([]*types.Job[I, T], 0, len(dq.jobs))
+	for len(dq.jobs) > 0 {
+		jobs = append(jobs, heap.Pop(&dq.jobs).(*delayedJob[I, T]).job)
+	}
+	return jobs
+}
+
+func (dq *delayQueue[I, T]) len() int {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	return len(dq.jobs)
+}
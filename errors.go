@@ -0,0 +1,31 @@
+package microbatcher
+
+import "errors"
+
+// ErrNotStarted is returned by Submit when the batcher is not started.
+var ErrNotStarted = errors.New("invalid submission since batcher is not started")
+
+// ErrQueueFull is returned by Submit when the job queue is full.
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrCircuitOpen is set on the result of every job which is failed fast since the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrBatchTimeout is set on the result of every job whose batch exceeded the configured batch timeout.
+var ErrBatchTimeout = errors.New("batch process timed out")
+
+// ErrRateLimited is returned by Submit when the submission rate limit is exceeded under the reject policy.
+var ErrRateLimited = errors.New("submission rate limit exceeded")
+
+// ErrPaused is returned by Flush when the batch dispatch is paused.
+var ErrPaused = errors.New("batcher is paused")
+
+// ErrJobExpired is set on the result of every job whose deadline passed before it was dispatched to the processor.
+var ErrJobExpired = errors.New("job expired before processing")
+
+// ErrDuplicateJob is returned by SubmitMany for a job whose ID occurs earlier in the same submission.
+var ErrDuplicateJob = errors.New("job id is submitted twice")
+
+// ErrSubmissionRejected is returned by SubmitMany in all-or-nothing mode for the jobs which are rejected since other
+// jobs of the submission are rejected.
+var ErrSubmissionRejected = errors.New("submission is rejected since other jobs are rejected")
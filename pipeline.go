@@ -0,0 +1,182 @@
+package microbatcher
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/types"
+	"sync"
+	"time"
+)
+
+const PIPELINE_BACKPRESSURE_INTERVAL_IN_MILLISECOND = 10
+
+// Stage is a batcher which is part of a pipeline.
+type Stage interface {
+	Start() error
+	Shutdown() error
+}
+
+// Pipeline connects several batchers, so that the successful results of one stage become the jobs of the next
+// stage. Jobs are submitted to the head stage, and the results of the last stage are read from its batcher.
+type Pipeline[I types.JobId, T any] struct {
+	head     Batcher[I, T]
+	stages   []Stage
+	mutex    sync.Mutex
+	stopping chan struct{}
+}
+
+// NewPipeline creates a new pipeline whose head stage is the given batcher.
+func NewPipeline[I types.JobId, T any](head Batcher[I, T]) *Pipeline[I, T] {
+	return &Pipeline[I, T]{
+		head:     head,
+		stages:   []Stage{head},
+		stopping: make(chan struct{}),
+	}
+}
+
+// AddStage appends the next stage to the pipeline. The successful results of from, which must be the last stage
+// of the pipeline, are mapped into jobs of next. Failed results stay in the results of from, and so do results
+// the mapper returns an error for.
+//
+// Forwarding blocks while the job queue of next is full, which holds up from and fills its job queue in turn.
+// This is how backpressure propagates up to the submissions of the pipeline. Once the pipeline shuts down,
+// forwarding gives up on a full job queue when next is paused or its circuit breaker is open, since its queue does
+// not drain then. A result which is not forwarded is failed with the rejection in the results of from.
+func AddStage[I types.JobId, T any, A any, B any](
+	pipeline *Pipeline[I, T],
+	from Batcher[I, A],
+	next Batcher[I, B],
+	mapper func(result *types.JobResult[I, A]) (*types.Job[I, B], error),
+) error {
+	if pipeline.stages[len(pipeline.stages)-1] != Stage(from) {
+		return errors.New("stage must follow the last stage of the pipeline")
+	}
+
+	fromName, nextName := from.Stats().Name, next.Stats().Name
+	clk := clockOf(from)
+	from.Subscribe(func(results []*types.JobResult[I, A]) {
+		for _, result := range results {
+			if result.Errors != nil {
+				continue
+			}
+
+			job, err := mapper(result)
+			if err != nil {
+				slog.Error(fmt.Sprintf("%s fails to map %s to %s: %s", fromName, result, nextName, err))
+				continue
+			}
+			if err := forward(clk, pipeline.stoppingChannel(), next, job); err != nil {
+				slog.Error(fmt.Sprintf("%s drops %s since it is rejected: %s", nextName, job, err))
+				if failer, ok := from.(recordedFailer[I]); ok {
+					failer.failRecorded(result.ID, fmt.Errorf("failed to forward to %s: %w", nextName, err))
+				}
+			}
+		}
+	})
+	pipeline.stages = append(pipeline.stages, next)
+	return nil
+}
+
+// recordedFailer is implemented by batchers which can fail a recorded result afterwards.
+type recordedFailer[I types.JobId] interface {
+	failRecorded(id I, err error)
+}
+
+// clockOf returns the clock of the batcher, which is the real clock for other implementations of Batcher.
+func clockOf[I types.JobId, T any](batcher Batcher[I, T]) clock.Clock {
+	if mb, ok := batcher.(*microBatcher[I, T]); ok {
+		return mb.clock
+	}
+	return clock.New()
+}
+
+// forward submits the job to the next stage and retries as long as its job queue is full. It waits between the
+// retries by the clock of the stage it forwards from. Once stopping is closed, it stops retrying when the next
+// stage does not drain its job queue, i.e. it is paused or its circuit breaker is open.
+func forward[I types.JobId, T any](
+	clk clock.Clock,
+	stopping <-chan struct{},
+	next Batcher[I, T],
+	job *types.Job[I, T],
+) error {
+	for {
+		_, err := next.Submit(job)
+		if err == nil || !errors.Is(err, ErrQueueFull) {
+			return err
+		}
+
+		select {
+		case <-stopping:
+			if next.IsPaused() || next.GetBreakerState() == breaker.StateOpen {
+				return err
+			}
+		default:
+		}
+
+		timer := clk.NewTimer(PIPELINE_BACKPRESSURE_INTERVAL_IN_MILLISECOND * time.Millisecond)
+		select {
+		case <-timer.C():
+		case <-stopping:
+			timer.Stop()
+		}
+	}
+}
+
+// stoppingChannel returns the channel which is closed once the pipeline shuts down.
+func (p *Pipeline[I, T]) stoppingChannel() <-chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.stopping
+}
+
+// Submit submits a new job to the head stage of the pipeline.
+func (p *Pipeline[I, T]) Submit(job *types.Job[I, T]) (*types.JobResult[I, T], error) {
+	return p.head.Submit(job)
+}
+
+// Start starts all stages from the last one to the head, so that every stage is ready before it receives jobs.
+// Stages which are started already are shut down again on failure.
+func (p *Pipeline[I, T]) Start() error {
+	p.mutex.Lock()
+	select {
+	case <-p.stopping:
+		p.stopping = make(chan struct{})
+	default:
+	}
+	p.mutex.Unlock()
+
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		if err := p.stages[i].Start(); err != nil {
+			for _, started := range p.stages[i+1:] {
+				_ = started.Shutdown()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown shuts down all stages from the head to the last one. Each stage forwards its remaining results to the
+// next stage before that one is shut down, so the pipeline returns after all accepted jobs passed every stage,
+// apart from results which are failed since a paused stage or an open circuit breaker does not take them.
+func (p *Pipeline[I, T]) Shutdown() error {
+	p.mutex.Lock()
+	select {
+	case <-p.stopping:
+	default:
+		close(p.stopping)
+	}
+	p.mutex.Unlock()
+
+	var errs []error
+	for _, stage := range p.stages {
+		if err := stage.Shutdown(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,211 @@
+package microbatcher
+
+import (
+	"errors"
+	"fmt"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/configs"
+	"microbatcher/pkg/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name               string
+		jobs               []*types.Job[string, string]
+		expectedJobResults map[string]*types.JobResult[string, string]
+	}{
+		{
+			name: "Results of every stage become the jobs of the next stage",
+			jobs: jobs,
+			expectedJobResults: map[string]*types.JobResult[string, string]{
+				"job1": {ID: "job1", Data: "17 is processed"},
+				"job2": {ID: "job2", Data: "17 is processed"},
+				"job3": {ID: "job3", Data: "17 is processed"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := configs.NewCustomConfig(10, 2, 5*time.Second)
+			enrich := NewMicroBatcher("enrich", &TestingMicroBatcherProcess[string]{}, cfg)
+			validate := NewMicroBatcher("validate", &TestingMapMicroBatcherProcess[string, int]{}, cfg)
+			write := NewMicroBatcher("write", &TestingIdentityMicroBatcherProcess{}, configs.NewDefaultConfig())
+
+			pipeline := NewPipeline(enrich)
+			assert.Nil(t, AddStage(pipeline, enrich, validate,
+				func(result *types.JobResult[string, string]) (*types.Job[string, int], error) {
+					return &types.Job[string, int]{ID: result.ID, Data: len(result.Data)}, nil
+				},
+			))
+			assert.Nil(t, AddStage(pipeline, validate, write,
+				func(result *types.JobResult[string, int]) (*types.Job[string, string], error) {
+					if result.Data == 0 {
+						return nil, errors.New("empty job")
+					}
+					return &types.Job[string, string]{ID: result.ID, Data: fmt.Sprintf("%d is processed", result.Data)}, nil
+				},
+			))
+
+			assert.Nil(t, pipeline.Start())
+			for _, job := range tt.jobs {
+				_, err := pipeline.Submit(job)
+				assert.Nil(t, err)
+			}
+			assert.Nil(t, pipeline.Shutdown())
+
+			results := write.GetCurrentResults()
+			assert.Equal(t, len(tt.expectedJobResults), len(results))
+			for _, result := range results {
+				expectedResult, ok := tt.expectedJobResults[result.ID]
+				assert.True(t, ok)
+				assert.Equal(t, expectedResult.Data, result.Data)
+			}
+		})
+	}
+}
+
+type TestingMapMicroBatcherProcess[I types.JobId, T any] struct{}
+
+func (tm *TestingMapMicroBatcherProcess[I, T]) Process(jobs []*types.Job[I, T]) []*types.JobResult[I, T] {
+	results := make([]*types.JobResult[I, T], 0)
+	for _, job := range jobs {
+		results = append(results, &types.JobResult[I, T]{
+			ID:   job.ID,
+			Data: job.Data,
+		})
+	}
+	return results
+}
+
+type TestingIdentityMicroBatcherProcess = TestingMapMicroBatcherProcess[string, string]
+
+func TestPipelineBackpressure(t *testing.T) {
+	headCfg, _ := configs.NewCustomConfig(2, 1, 5*time.Second)
+	tailCfg, _ := configs.NewCustomConfig(2, 1, 5*time.Second)
+	head := NewMicroBatcher("head", &TestingIdentityMicroBatcherProcess{}, headCfg)
+	tail := NewMicroBatcher("tail", &TestingMicroBatcherProcess[string]{
+		slow:          true,
+		sleepDuration: 1 * time.Minute,
+	}, tailCfg)
+
+	pipeline := NewPipeline(head)
+	assert.Nil(t, AddStage(pipeline, head, tail, func(result *types.JobResult[string, string]) (*types.Job[string, string], error) {
+		return &types.Job[string, string]{ID: result.ID, Data: result.Data}, nil
+	}))
+	assert.Nil(t, pipeline.Start())
+
+	// the tail blocks in its first batch and queues two jobs, the head blocks forwarding its next result and
+	// queues two jobs, then the pipeline is full
+	var lastErr error
+	for i := 0; i < 10 && lastErr == nil; i++ {
+		_, lastErr = pipeline.Submit(&types.Job[string, string]{ID: fmt.Sprintf("job%d", i)})
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.ErrorIs(t, lastErr, ErrQueueFull)
+}
+
+func TestPipelineForwardWaitsByClock(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(2, 1, time.Hour)
+	processor := &TestingGatedMicroBatcherProcess[string]{started: make(chan struct{}, 1), release: make(chan struct{})}
+	next := NewMicroBatcher("next", processor, cfg)
+	assert.Nil(t, next.Start())
+
+	// the first batch blocks the execute loop, so that the job queue fills up
+	for i := 0; i < 3; i++ {
+		_, err := next.Submit(&types.Job[string, string]{ID: fmt.Sprintf("blocking%d", i)})
+		assert.Nil(t, err)
+		if i == 0 {
+			<-processor.started
+		}
+	}
+
+	fakeClock := clock.NewFake(time.Now())
+	forwarded := make(chan struct{})
+	go func() {
+		assert.Nil(t, forward(fakeClock, nil, next, &types.Job[string, string]{ID: "job1"}))
+		close(forwarded)
+	}()
+
+	// the forward waits for the fake time while the job queue is full
+	fakeClock.BlockUntilTimers(1)
+	close(processor.release)
+	assert.Eventually(t, func() bool {
+		return next.queueDepth() == 0
+	}, time.Second, time.Millisecond)
+	_, ok := next.Status("job1")
+	assert.False(t, ok)
+
+	fakeClock.Advance(PIPELINE_BACKPRESSURE_INTERVAL_IN_MILLISECOND * time.Millisecond)
+	select {
+	case <-forwarded:
+	case <-time.After(time.Second):
+		t.Fatal("job is not forwarded")
+	}
+	_, ok = next.Status("job1")
+	assert.True(t, ok)
+	assert.Nil(t, next.Shutdown())
+}
+
+func TestPipelineShutdownWithPausedStage(t *testing.T) {
+	headCfg, _ := configs.NewCustomConfig(10, 1, time.Hour)
+	nextCfg, _ := configs.NewCustomConfig(2, 1, time.Hour)
+	head := NewMicroBatcher("head", &TestingIdentityMicroBatcherProcess{}, headCfg)
+	next := NewMicroBatcher("next", &TestingIdentityMicroBatcherProcess{}, nextCfg)
+
+	pipeline := NewPipeline(head)
+	assert.Nil(t, AddStage(pipeline, head, next, func(result *types.JobResult[string, string]) (*types.Job[string, string], error) {
+		return &types.Job[string, string]{ID: result.ID, Data: result.Data}, nil
+	}))
+	assert.Nil(t, pipeline.Start())
+	assert.Nil(t, next.Pause())
+
+	// the paused stage fills up, so that the head blocks forwarding its results
+	for i := 0; i < 8; i++ {
+		_, err := pipeline.Submit(&types.Job[string, string]{ID: fmt.Sprintf("job%d", i)})
+		assert.Nil(t, err)
+	}
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- pipeline.Shutdown()
+	}()
+	select {
+	case err := <-shutdown:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline does not shut down")
+	}
+
+	// the results which are not forwarded are failed by the head
+	failed := 0
+	for _, result := range head.GetCurrentResults() {
+		if result.Errors == nil {
+			continue
+		}
+		failed++
+		assert.ErrorIs(t, result.Errors, ErrQueueFull)
+		status, ok := head.Status(result.ID)
+		assert.True(t, ok)
+		assert.Equal(t, types.JobStatusFailed, status.Status)
+	}
+	assert.Len(t, head.GetCurrentResults(), 8)
+	assert.Greater(t, failed, 0)
+	assert.Equal(t, failed, head.Stats().JobsFailed)
+}
+
+func TestAddStageError(t *testing.T) {
+	head := NewMicroBatcher("head", &TestingMicroBatcherProcess[string]{}, configs.NewDefaultConfig())
+	other := NewMicroBatcher("other", &TestingMicroBatcherProcess[string]{}, configs.NewDefaultConfig())
+	next := NewMicroBatcher("next", &TestingMicroBatcherProcess[string]{}, configs.NewDefaultConfig())
+
+	pipeline := NewPipeline(head)
+	err := AddStage(pipeline, other, next, func(result *types.JobResult[string, string]) (*types.Job[string, string], error) {
+		return &types.Job[string, string]{ID: result.ID}, nil
+	})
+	assert.EqualError(t, err, "stage must follow the last stage of the pipeline")
+}
@@ -0,0 +1,258 @@
+// Package admin provides an HTTP handler to inspect and control running batchers.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"microbatcher"
+	"microbatcher/pkg/types"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DEFAULT_SATURATION_THRESHOLD = 0.9
+
+// managed is a registered batcher with its type parameters erased, so that batchers of different job types can
+// be served by one handler.
+type managed struct {
+	stats    func() microbatcher.Stats
+	flush    func(ctx context.Context) error
+	pause    func() error
+	resume   func() error
+	shutdown func() error
+	results  func(id string) []resultJSON
+}
+
+type resultJSON struct {
+	ID            any             `json:"id"`
+	Data          any             `json:"data"`
+	Error         string          `json:"error,omitempty"`
+	Status        types.JobStatus `json:"status"`
+	BatchSequence int             `json:"batch_sequence,omitempty"`
+	Attempts      int             `json:"attempts,omitempty"`
+	FinishedAt    *time.Time      `json:"finished_at,omitempty"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+type healthJSON struct {
+	Status string `json:"status"`
+}
+
+type readinessJSON struct {
+	Ready    bool     `json:"ready"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Handler serves the admin endpoints of the registered batchers:
+//
+//	GET  /batchers                       stats of all batchers
+//	POST /batchers/{name}/flush          flush a batcher
+//	POST /batchers/{name}/pause          pause a batcher
+//	POST /batchers/{name}/resume         resume a batcher
+//	POST /batchers/{name}/shutdown       shut down a batcher
+//	GET  /batchers/{name}/results?id=    current results of a batcher, optionally of one job ID
+//	GET  /healthz                        liveness of the handler
+//	GET  /readyz                         readiness of all batchers
+//
+// A batcher is ready while it is running and its job queue is below the saturation threshold.
+type Handler struct {
+	mutex               sync.RWMutex
+	batchers            map[string]*managed
+	saturationThreshold float64
+	mux                 *http.ServeMux
+}
+
+// NewHandler creates a new admin handler without registered batchers. The saturation threshold is the ratio
+// of queue depth to queue capacity from which a batcher is not ready anymore.
+func NewHandler(saturationThreshold float64) (*Handler, error) {
+	if saturationThreshold <= 0 || saturationThreshold > 1 {
+		return nil, errors.New("saturationThreshold must be greater than 0 and at most 1")
+	}
+
+	h := &Handler{
+		batchers:            make(map[string]*managed),
+		saturationThreshold: saturationThreshold,
+		mux:                 http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /batchers", h.listStats)
+	h.mux.HandleFunc("POST /batchers/{name}/flush", h.control(func(r *http.Request, m *managed) error {
+		return m.flush(r.Context())
+	}))
+	h.mux.HandleFunc("POST /batchers/{name}/pause", h.control(func(r *http.Request, m *managed) error {
+		return m.pause()
+	}))
+	h.mux.HandleFunc("POST /batchers/{name}/resume", h.control(func(r *http.Request, m *managed) error {
+		return m.resume()
+	}))
+	h.mux.HandleFunc("POST /batchers/{name}/shutdown", h.control(func(r *http.Request, m *managed) error {
+		return m.shutdown()
+	}))
+	h.mux.HandleFunc("GET /batchers/{name}/results", h.results)
+	h.mux.HandleFunc("GET /healthz", h.health)
+	h.mux.HandleFunc("GET /readyz", h.readiness)
+	return h, nil
+}
+
+// Register registers the batcher under the given name, which is also the name of its served stats. The name must
+// not be empty or registered already.
+func Register[I types.JobId, T any](h *Handler, name string, batcher microbatcher.Batcher[I, T]) error {
+	if name == "" {
+		return errors.New("name must not be empty")
+	}
+
+	m := &managed{
+		stats: func() microbatcher.Stats {
+			stats := batcher.Stats()
+			stats.Name = name
+			return stats
+		},
+		flush:    batcher.Flush,
+		pause:    batcher.Pause,
+		resume:   batcher.Resume,
+		shutdown: batcher.Shutdown,
+		results: func(id string) []resultJSON {
+			matched := make([]resultJSON, 0)
+			for _, result := range batcher.GetCurrentResults() {
+				if id != "" && fmt.Sprint(result.ID) != id {
+					continue
+				}
+				encoded := resultJSON{
+					ID:            result.ID,
+					Data:          result.Data,
+					Status:        result.Status,
+					BatchSequence: result.BatchSequence,
+					Attempts:      result.Attempts,
+				}
+				if result.Errors != nil {
+					encoded.Error = result.Errors.Error()
+				}
+				if !result.FinishedAt.IsZero() {
+					encoded.FinishedAt = &result.FinishedAt
+				}
+				matched = append(matched, encoded)
+			}
+			return matched
+		},
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.batchers[name]; ok {
+		return fmt.Errorf("batcher %s is registered already", name)
+	}
+	h.batchers[name] = m
+	return nil
+}
+
+// Unregister removes the batcher with the given name.
+func (h *Handler) Unregister(name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.batchers, name)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) lookup(name string) (*managed, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	m, ok := h.batchers[name]
+	return m, ok
+}
+
+// snapshot returns the stats of all batchers sorted by name.
+func (h *Handler) snapshot() []microbatcher.Stats {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	stats := make([]microbatcher.Stats, 0, len(h.batchers))
+	for _, m := range h.batchers {
+		stats = append(stats, m.stats())
+	}
+	sort.Slice(stats, func(a, b int) bool {
+		return stats[a].Name < stats[b].Name
+	})
+	return stats
+}
+
+func (h *Handler) listStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.snapshot())
+}
+
+// control returns the handler of a control endpoint. Errors of the batcher, such as pausing a paused batcher,
+// are conflicts with its current state.
+func (h *Handler) control(operation func(r *http.Request, m *managed) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		m, ok := h.lookup(name)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errorJSON{Error: fmt.Sprintf("batcher %s is not registered", name)})
+			return
+		}
+
+		if err := operation(r, m); err != nil {
+			slog.Warn(fmt.Sprintf("admin fails to control %s: %s", name, err))
+			writeJSON(w, http.StatusConflict, errorJSON{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, m.stats())
+	}
+}
+
+func (h *Handler) results(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	m, ok := h.lookup(name)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorJSON{Error: fmt.Sprintf("batcher %s is not registered", name)})
+		return
+	}
+	writeJSON(w, http.StatusOK, m.results(r.URL.Query().Get("id")))
+}
+
+func (h *Handler) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthJSON{Status: "ok"})
+}
+
+func (h *Handler) readiness(w http.ResponseWriter, r *http.Request) {
+	readiness := readinessJSON{Ready: true}
+	for _, stats := range h.snapshot() {
+		if !stats.Running {
+			readiness.Failures = append(readiness.Failures, fmt.Sprintf("%s is not running", stats.Name))
+			continue
+		}
+
+		if stats.QueueCapacity > 0 &&
+			float64(stats.QueueDepth)/float64(stats.QueueCapacity) >= h.saturationThreshold {
+			readiness.Failures = append(readiness.Failures,
+				fmt.Sprintf("%s queue is saturated with %d of %d jobs", stats.Name, stats.QueueDepth, stats.QueueCapacity))
+		}
+	}
+
+	if len(readiness.Failures) > 0 {
+		readiness.Ready = false
+		writeJSON(w, http.StatusServiceUnavailable, readiness)
+		return
+	}
+	writeJSON(w, http.StatusOK, readiness)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error(fmt.Sprintf("admin fails to write response: %s", err))
+	}
+}
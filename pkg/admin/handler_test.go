@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"microbatcher"
+	"microbatcher/pkg/batchertest"
+	"microbatcher/pkg/configs"
+	"microbatcher/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestingAdminProcess struct{}
+
+func (tp *TestingAdminProcess) Process(jobs []*types.Job[int, string]) []*types.JobResult[int, string] {
+	results := make([]*types.JobResult[int, string], 0)
+	for _, job := range jobs {
+		results = append(results, &types.JobResult[int, string]{
+			ID:   job.ID,
+			Data: fmt.Sprintf("%v is processed", job.ID),
+		})
+	}
+	return results
+}
+
+func newTestingServer(t *testing.T) (*httptest.Server, map[string]microbatcher.Batcher[int, string]) {
+	handler, err := NewHandler(DEFAULT_SATURATION_THRESHOLD)
+	assert.Nil(t, err)
+
+	cfg, _ := configs.NewCustomConfig(10, 5, 5*time.Second)
+	batchers := map[string]microbatcher.Batcher[int, string]{
+		"alpha": microbatcher.NewMicroBatcher("alpha", &TestingAdminProcess{}, cfg),
+		"beta":  microbatcher.NewMicroBatcher("beta", &TestingAdminProcess{}, cfg),
+	}
+	for name, batcher := range batchers {
+		assert.Nil(t, Register(handler, name, batcher))
+		assert.Nil(t, batcher.Start())
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server, batchers
+}
+
+func request(t *testing.T, method string, url string, body any) int {
+	req, _ := http.NewRequest(method, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	if body != nil {
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(body))
+	}
+	return resp.StatusCode
+}
+
+func TestHandlerListStats(t *testing.T) {
+	server, batchers := newTestingServer(t)
+	_, _ = batchers["beta"].Submit(&types.Job[int, string]{ID: 1})
+
+	var stats []map[string]any
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/batchers", &stats))
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "alpha", stats[0]["name"])
+	assert.Equal(t, "beta", stats[1]["name"])
+	assert.Equal(t, true, stats[1]["running"])
+	assert.Equal(t, float64(10), stats[1]["queue_capacity"])
+}
+
+func TestRegister(t *testing.T) {
+	handler, err := NewHandler(DEFAULT_SATURATION_THRESHOLD)
+	assert.Nil(t, err)
+
+	// fakes have no name of their own, so they are served by their registered names
+	assert.Nil(t, Register[int, string](handler, "first", batchertest.NewFake[int, string]()))
+	assert.Nil(t, Register[int, string](handler, "second", batchertest.NewFake[int, string]()))
+	assert.EqualError(t, Register[int, string](handler, "", batchertest.NewFake[int, string]()),
+		"name must not be empty")
+	assert.EqualError(t, Register[int, string](handler, "first", batchertest.NewFake[int, string]()),
+		"batcher first is registered already")
+
+	names := make([]string, 0)
+	for _, stats := range handler.snapshot() {
+		names = append(names, stats.Name)
+	}
+	assert.Equal(t, []string{"first", "second"}, names)
+
+	// an unregistered name can be registered again
+	handler.Unregister("first")
+	assert.Nil(t, Register[int, string](handler, "first", batchertest.NewFake[int, string]()))
+}
+
+func TestHandlerControl(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   map[string]any
+	}{
+		{
+			name:           "Pause a running batcher",
+			path:           "/batchers/alpha/pause",
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]any{"paused": true},
+		},
+		{
+			name:           "Resume a batcher which is not paused",
+			path:           "/batchers/alpha/resume",
+			expectedStatus: http.StatusConflict,
+			expectedBody:   map[string]any{"error": "batcher is not paused"},
+		},
+		{
+			name:           "Flush a batcher",
+			path:           "/batchers/alpha/flush",
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]any{"jobs_processed": float64(2)},
+		},
+		{
+			name:           "Shut down a batcher",
+			path:           "/batchers/alpha/shutdown",
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]any{"running": false},
+		},
+		{
+			name:           "Control a batcher which is not registered",
+			path:           "/batchers/gamma/flush",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   map[string]any{"error": "batcher gamma is not registered"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, batchers := newTestingServer(t)
+			for i := 0; i < 2; i++ {
+				_, _ = batchers["alpha"].Submit(&types.Job[int, string]{ID: i})
+			}
+
+			var body map[string]any
+			assert.Equal(t, tt.expectedStatus, request(t, http.MethodPost, server.URL+tt.path, &body))
+			for key, expected := range tt.expectedBody {
+				assert.Equal(t, expected, body[key])
+			}
+		})
+	}
+}
+
+func TestHandlerResults(t *testing.T) {
+	server, batchers := newTestingServer(t)
+	for i := 0; i < 3; i++ {
+		_, _ = batchers["alpha"].Submit(&types.Job[int, string]{ID: i})
+	}
+	request(t, http.MethodPost, server.URL+"/batchers/alpha/flush", nil)
+
+	var all []map[string]any
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/batchers/alpha/results", &all))
+	assert.Len(t, all, 3)
+
+	var one []map[string]any
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/batchers/alpha/results?id=2", &one))
+	assert.Len(t, one, 1)
+	assert.NotEmpty(t, one[0]["finished_at"])
+	delete(one[0], "finished_at")
+	assert.Equal(t, []map[string]any{{
+		"id":             float64(2),
+		"data":           "2 is processed",
+		"status":         "succeeded",
+		"batch_sequence": float64(1),
+		"attempts":       float64(1),
+	}}, one)
+}
+
+func TestHandlerReadiness(t *testing.T) {
+	server, batchers := newTestingServer(t)
+
+	var health map[string]any
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/healthz", &health))
+	assert.Equal(t, "ok", health["status"])
+
+	var readiness readinessJSON
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/readyz", &readiness))
+	assert.True(t, readiness.Ready)
+
+	// a paused batcher keeps jobs in the queue once its pending batch is full
+	assert.Nil(t, batchers["beta"].Pause())
+	assert.Eventually(t, func() bool {
+		_, _ = batchers["beta"].Submit(&types.Job[int, string]{ID: 1})
+		return batchers["beta"].Stats().QueueDepth == 10
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, batchers["alpha"].Shutdown())
+
+	assert.Equal(t, http.StatusServiceUnavailable, request(t, http.MethodGet, server.URL+"/readyz", &readiness))
+	assert.False(t, readiness.Ready)
+	assert.Equal(t, []string{"alpha is not running", "beta queue is saturated with 10 of 10 jobs"}, readiness.Failures)
+}
+
+func TestNewHandlerError(t *testing.T) {
+	handler, err := NewHandler(0)
+	assert.Nil(t, handler)
+	assert.EqualError(t, err, "saturationThreshold must be greater than 0 and at most 1")
+}
@@ -0,0 +1,435 @@
+// Package batchertest provides a fake batcher for testing code which depends on microbatcher.Batcher.
+package batchertest
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"microbatcher"
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/ratelimit"
+	"microbatcher/pkg/types"
+	"sync"
+	"time"
+)
+
+// Fake is a batcher which records the submitted jobs instead of batching them. Results are scripted either by
+// a process function called on every submission or by adding them explicitly.
+type Fake[I types.JobId, T any] struct {
+	mutex            sync.Mutex
+	running          bool
+	paused           bool
+	submissions      []*types.Job[I, T]
+	delayed          []*types.Job[I, T]
+	results          []*types.JobResult[I, T]
+	subscribers      map[int]func(results []*types.JobResult[I, T])
+	batchSubscribers map[int]func(batchResult *types.BatchResult[I, T])
+	nextId           int
+	submitErr        error
+	processFunc      func(job *types.Job[I, T]) *types.JobResult[I, T]
+	breakerState     breaker.State
+	batchesLimit     ratelimit.Limit
+	itemsLimit       ratelimit.Limit
+	submitLimit      ratelimit.Limit
+	flushes          int
+}
+
+var _ microbatcher.Batcher[int, string] = (*Fake[int, string])(nil)
+
+// NewFake creates a new fake batcher which is not started.
+func NewFake[I types.JobId, T any]() *Fake[I, T] {
+	return &Fake[I, T]{
+		subscribers:      make(map[int]func(results []*types.JobResult[I, T])),
+		batchSubscribers: make(map[int]func(batchResult *types.BatchResult[I, T])),
+	}
+}
+
+// Submit records the job and returns a job result with queued state, or the scripted submit error.
+func (f *Fake[I, T]) Submit(job *types.Job[I, T]) (*types.JobResult[I, T], error) {
+	f.mutex.Lock()
+	if !f.running {
+		f.mutex.Unlock()
+		return nil, microbatcher.ErrNotStarted
+	}
+
+	if f.submitErr != nil {
+		f.mutex.Unlock()
+		return nil, f.submitErr
+	}
+	f.submissions = append(f.submissions, job)
+	processFunc := f.processFunc
+	f.mutex.Unlock()
+
+	if processFunc != nil {
+		f.AddResults(processFunc(job))
+	}
+	return &types.JobResult[I, T]{ID: job.ID, Status: types.JobStatusQueued, SubmittedAt: time.Now()}, nil
+}
+
+// SubmitMany submits the jobs one by one, and rejects jobs whose ID occurs earlier in the jobs with
+// ErrDuplicateJob. In all-or-nothing mode, the jobs are rejected before any of them is recorded when a job is
+// duplicated, or by the scripted submit error, or when the fake batcher is not started.
+func (f *Fake[I, T]) SubmitMany(
+	jobs []*types.Job[I, T],
+	mode microbatcher.SubmitMode,
+) ([]microbatcher.Admission[I, T], error) {
+	admissions := make([]microbatcher.Admission[I, T], len(jobs))
+	seen := make(map[I]bool, len(jobs))
+	var firstErr error
+	for i, job := range jobs {
+		admissions[i].ID = job.ID
+		if seen[job.ID] {
+			admissions[i].Err = microbatcher.ErrDuplicateJob
+			firstErr = cmp.Or(firstErr, microbatcher.ErrDuplicateJob)
+		}
+		seen[job.ID] = true
+	}
+
+	if mode == microbatcher.SubmitAllOrNothing {
+		f.mutex.Lock()
+		if !f.running {
+			firstErr = cmp.Or(firstErr, microbatcher.ErrNotStarted)
+		}
+		firstErr = cmp.Or(firstErr, f.submitErr)
+		f.mutex.Unlock()
+
+		if firstErr != nil {
+			for i := range admissions {
+				if admissions[i].Err == nil {
+					admissions[i].Err = microbatcher.ErrSubmissionRejected
+				}
+			}
+			return admissions, firstErr
+		}
+	}
+
+	for i, job := range jobs {
+		if admissions[i].Err == nil {
+			admissions[i].Result, admissions[i].Err = f.Submit(job)
+		}
+	}
+	return admissions, nil
+}
+
+// SubmitAt submits the job straight away when it is due. Otherwise, it keeps the job delayed until it is taken by
+// TakeDelayed, since the fake batcher does not move time.
+func (f *Fake[I, T]) SubmitAt(job *types.Job[I, T], notBefore time.Time) (*types.JobResult[I, T], error) {
+	if !notBefore.After(time.Now()) {
+		return f.Submit(job)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.running {
+		return nil, microbatcher.ErrNotStarted
+	}
+
+	if f.submitErr != nil {
+		return nil, f.submitErr
+	}
+	f.delayed = append(f.delayed, job)
+	return &types.JobResult[I, T]{ID: job.ID, Status: types.JobStatusAccepted, SubmittedAt: time.Now()}, nil
+}
+
+// TakeDelayed removes and returns the delayed jobs in order of submission.
+func (f *Fake[I, T]) TakeDelayed() []*types.Job[I, T] {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delayed := f.delayed
+	f.delayed = nil
+	return delayed
+}
+
+// Status returns the latest scripted result of the job, or a queued or accepted result while the job is submitted
+// or delayed without result.
+func (f *Fake[I, T]) Status(id I) (*types.JobResult[I, T], bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i := len(f.results) - 1; i >= 0; i-- {
+		if f.results[i].ID == id {
+			return f.results[i], true
+		}
+	}
+	for _, job := range f.delayed {
+		if job.ID == id {
+			return &types.JobResult[I, T]{ID: id, Status: types.JobStatusAccepted}, true
+		}
+	}
+	for _, job := range f.submissions {
+		if job.ID == id {
+			return &types.JobResult[I, T]{ID: id, Status: types.JobStatusQueued}, true
+		}
+	}
+	return nil, false
+}
+
+// Start starts the fake batcher. Unlike a real batcher, the recorded submissions and results are kept.
+func (f *Fake[I, T]) Start() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.running {
+		return errors.New("batcher is started already")
+	}
+	f.running = true
+	return nil
+}
+
+// Shutdown stops the fake batcher.
+func (f *Fake[I, T]) Shutdown() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.running {
+		return errors.New("invalid shutdown since batcher is stopped")
+	}
+	f.running = false
+	f.paused = false
+	return nil
+}
+
+// Flush counts the flush, since results are scripted straight away on submission.
+func (f *Fake[I, T]) Flush(ctx context.Context) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.running {
+		return errors.New("invalid flush since batcher is not started")
+	}
+	f.flushes++
+	return ctx.Err()
+}
+
+// Pause pauses the fake batcher, which only changes the reported paused state.
+func (f *Fake[I, T]) Pause() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.running {
+		return errors.New("invalid pause since batcher is not started")
+	}
+
+	if f.paused {
+		return errors.New("batcher is paused already")
+	}
+	f.paused = true
+	return nil
+}
+
+// Resume resumes the fake batcher.
+func (f *Fake[I, T]) Resume() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.running {
+		return errors.New("invalid resume since batcher is not started")
+	}
+
+	if !f.paused {
+		return errors.New("batcher is not paused")
+	}
+	f.paused = false
+	return nil
+}
+
+// IsPaused reports whether the fake batcher is paused.
+func (f *Fake[I, T]) IsPaused() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.paused
+}
+
+// Stats returns the stats of the fake batcher, which counts the scripted results as processed jobs.
+func (f *Fake[I, T]) Stats() microbatcher.Stats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	stats := microbatcher.Stats{
+		Running:       f.running,
+		Paused:        f.paused,
+		DelayedJobs:   len(f.delayed),
+		JobsProcessed: len(f.results),
+		BreakerState:  f.breakerState,
+	}
+	for _, result := range f.results {
+		if result.Errors != nil {
+			stats.JobsFailed++
+			stats.LastError = result.Errors
+		}
+	}
+	return stats
+}
+
+// GetCurrentResults returns the scripted results.
+func (f *Fake[I, T]) GetCurrentResults() []*types.JobResult[I, T] {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	clonedResults := make([]*types.JobResult[I, T], len(f.results))
+	copy(clonedResults, f.results)
+	return clonedResults
+}
+
+// SubscribeBatches registers a function which receives the scripted results as batch results.
+func (f *Fake[I, T]) SubscribeBatches(
+	subscriber func(batchResult *types.BatchResult[I, T]),
+) (unsubscribe func()) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	id := f.nextId
+	f.nextId++
+	f.batchSubscribers[id] = subscriber
+
+	return func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+
+		delete(f.batchSubscribers, id)
+	}
+}
+
+// Subscribe registers a function which receives the scripted results.
+func (f *Fake[I, T]) Subscribe(subscriber func(results []*types.JobResult[I, T])) (unsubscribe func()) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	id := f.nextId
+	f.nextId++
+	f.subscribers[id] = subscriber
+
+	return func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+
+		delete(f.subscribers, id)
+	}
+}
+
+// GetBreakerState returns the scripted circuit breaker state, which is closed by default.
+func (f *Fake[I, T]) GetBreakerState() breaker.State {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.breakerState
+}
+
+// SetDispatchRateLimit records the dispatch rate limits.
+func (f *Fake[I, T]) SetDispatchRateLimit(batches ratelimit.Limit, items ratelimit.Limit) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.batchesLimit = batches
+	f.itemsLimit = items
+}
+
+// SetSubmitRateLimit records the submit rate limit.
+func (f *Fake[I, T]) SetSubmitRateLimit(submit ratelimit.Limit) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.submitLimit = submit
+}
+
+// Submissions returns the jobs accepted by Submit in order.
+func (f *Fake[I, T]) Submissions() []*types.Job[I, T] {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	clonedSubmissions := make([]*types.Job[I, T], len(f.submissions))
+	copy(clonedSubmissions, f.submissions)
+	return clonedSubmissions
+}
+
+// Flushes returns the number of successful Flush calls.
+func (f *Fake[I, T]) Flushes() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.flushes
+}
+
+// GetDispatchRateLimit returns the dispatch rate limits set last.
+func (f *Fake[I, T]) GetDispatchRateLimit() (batches ratelimit.Limit, items ratelimit.Limit) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.batchesLimit, f.itemsLimit
+}
+
+// GetSubmitRateLimit returns the submit rate limit set last.
+func (f *Fake[I, T]) GetSubmitRateLimit() ratelimit.Limit {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.submitLimit
+}
+
+// SetSubmitError scripts the error returned by every following Submit. Nil accepts submissions again.
+func (f *Fake[I, T]) SetSubmitError(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.submitErr = err
+}
+
+// SetProcessFunc scripts the result of every following submission. The result is recorded and published to
+// the subscribers straight away. A nil result records nothing, like a processor dropping the job.
+func (f *Fake[I, T]) SetProcessFunc(processFunc func(job *types.Job[I, T]) *types.JobResult[I, T]) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.processFunc = processFunc
+}
+
+// SetBreakerState scripts the circuit breaker state.
+func (f *Fake[I, T]) SetBreakerState(state breaker.State) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.breakerState = state
+}
+
+// AddResults records the results and publishes them to the subscribers as one batch.
+func (f *Fake[I, T]) AddResults(results ...*types.JobResult[I, T]) {
+	f.AddBatchResult(&types.BatchResult[I, T]{Results: results})
+}
+
+// AddBatchResult records the results of the batch result and publishes it to the subscribers, e.g. to script a
+// batch error or metadata.
+func (f *Fake[I, T]) AddBatchResult(batchResult *types.BatchResult[I, T]) {
+	var recorded []*types.JobResult[I, T]
+	for _, result := range batchResult.Results {
+		if result != nil {
+			recorded = append(recorded, result)
+		}
+	}
+	if len(recorded) == 0 && batchResult.Error == nil {
+		return
+	}
+	published := *batchResult
+	published.Results = recorded
+
+	f.mutex.Lock()
+	f.results = append(f.results, recorded...)
+	subscribers := make([]func(results []*types.JobResult[I, T]), 0, len(f.subscribers))
+	for _, subscriber := range f.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	batchSubscribers := make([]func(batchResult *types.BatchResult[I, T]), 0, len(f.batchSubscribers))
+	for _, subscriber := range f.batchSubscribers {
+		batchSubscribers = append(batchSubscribers, subscriber)
+	}
+	f.mutex.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(recorded)
+	}
+	for _, subscriber := range batchSubscribers {
+		subscriber(&published)
+	}
+}
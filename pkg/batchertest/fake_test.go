@@ -0,0 +1,151 @@
+package batchertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"microbatcher"
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/ratelimit"
+	"microbatcher/pkg/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jobSource is a typical consumer which only knows the Batcher interface.
+type jobSource struct {
+	batcher microbatcher.Batcher[int, string]
+}
+
+func (js *jobSource) emit(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := js.batcher.Submit(&types.Job[int, string]{ID: i, Data: fmt.Sprintf("data %d", i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestFakeRecordsSubmissions(t *testing.T) {
+	fake := NewFake[int, string]()
+	source := &jobSource{batcher: fake}
+
+	assert.ErrorIs(t, source.emit(1), microbatcher.ErrNotStarted)
+	assert.Nil(t, fake.Start())
+	assert.Nil(t, source.emit(3))
+
+	submissions := fake.Submissions()
+	assert.Len(t, submissions, 3)
+	assert.Equal(t, "data 2", submissions[2].Data)
+
+	fake.SetSubmitError(microbatcher.ErrQueueFull)
+	assert.ErrorIs(t, source.emit(1), microbatcher.ErrQueueFull)
+	assert.Len(t, fake.Submissions(), 3)
+
+	assert.Nil(t, fake.Flush(context.Background()))
+	assert.Equal(t, 1, fake.Flushes())
+
+	assert.Nil(t, fake.Pause())
+	assert.True(t, fake.IsPaused())
+	assert.EqualError(t, fake.Pause(), "batcher is paused already")
+	assert.Nil(t, fake.Resume())
+	assert.False(t, fake.IsPaused())
+	assert.Nil(t, fake.Shutdown())
+}
+
+func TestFakeKeepsDelayedJobs(t *testing.T) {
+	fake := NewFake[int, string]()
+	assert.Nil(t, fake.Start())
+
+	_, err := fake.SubmitAt(&types.Job[int, string]{ID: 1}, time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+	_, err = fake.SubmitAt(&types.Job[int, string]{ID: 2}, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+
+	assert.Len(t, fake.Submissions(), 1)
+	assert.Equal(t, 1, fake.Stats().DelayedJobs)
+
+	status, ok := fake.Status(2)
+	assert.True(t, ok)
+	assert.Equal(t, types.JobStatusAccepted, status.Status)
+	status, ok = fake.Status(1)
+	assert.True(t, ok)
+	assert.Equal(t, types.JobStatusQueued, status.Status)
+	_, ok = fake.Status(3)
+	assert.False(t, ok)
+	assert.Equal(t, []*types.Job[int, string]{{ID: 2}}, fake.TakeDelayed())
+	assert.Empty(t, fake.TakeDelayed())
+	assert.Nil(t, fake.Shutdown())
+}
+
+func TestFakeScriptsResults(t *testing.T) {
+	fake := NewFake[int, string]()
+	fake.SetProcessFunc(func(job *types.Job[int, string]) *types.JobResult[int, string] {
+		if job.ID == 1 {
+			return &types.JobResult[int, string]{ID: job.ID, Errors: errors.New("poison job")}
+		}
+		return &types.JobResult[int, string]{ID: job.ID, Data: "processed " + job.Data}
+	})
+
+	var received []*types.JobResult[int, string]
+	fake.Subscribe(func(results []*types.JobResult[int, string]) {
+		received = append(received, results...)
+	})
+
+	assert.Nil(t, fake.Start())
+	assert.Nil(t, (&jobSource{batcher: fake}).emit(2))
+	fake.AddResults(&types.JobResult[int, string]{ID: 99, Data: "scripted"})
+
+	results := fake.GetCurrentResults()
+	assert.Equal(t, results, received)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "processed data 0", results[0].Data)
+	assert.EqualError(t, results[1].Errors, "poison job")
+	assert.Equal(t, 99, results[2].ID)
+
+	stats := fake.Stats()
+	assert.True(t, stats.Running)
+	assert.Equal(t, 3, stats.JobsProcessed)
+	assert.Equal(t, 1, stats.JobsFailed)
+	assert.EqualError(t, stats.LastError, "poison job")
+}
+
+func TestFakeRecordsSettings(t *testing.T) {
+	fake := NewFake[int, string]()
+	fake.SetBreakerState(breaker.StateOpen)
+	fake.SetDispatchRateLimit(ratelimit.Limit{Rate: 1, Burst: 1}, ratelimit.Limit{Rate: 10, Burst: 10})
+	fake.SetSubmitRateLimit(ratelimit.Limit{Rate: 5, Burst: 2})
+
+	assert.Equal(t, breaker.StateOpen, fake.GetBreakerState())
+	batches, items := fake.GetDispatchRateLimit()
+	assert.Equal(t, ratelimit.Limit{Rate: 1, Burst: 1}, batches)
+	assert.Equal(t, ratelimit.Limit{Rate: 10, Burst: 10}, items)
+	assert.Equal(t, ratelimit.Limit{Rate: 5, Burst: 2}, fake.GetSubmitRateLimit())
+}
+
+func TestFakeSubmitMany(t *testing.T) {
+	fake := NewFake[int, string]()
+	jobs := []*types.Job[int, string]{{ID: 1}, {ID: 2}}
+
+	admissions, err := fake.SubmitMany(jobs, microbatcher.SubmitAllOrNothing)
+	assert.ErrorIs(t, err, microbatcher.ErrNotStarted)
+	assert.Equal(t, microbatcher.ErrSubmissionRejected, admissions[1].Err)
+
+	assert.Nil(t, fake.Start())
+	admissions, err = fake.SubmitMany(jobs, microbatcher.SubmitBestEffort)
+	assert.Nil(t, err)
+	for _, admission := range admissions {
+		assert.True(t, admission.Accepted())
+		assert.Equal(t, types.JobStatusQueued, admission.Result.Status)
+	}
+	assert.Equal(t, jobs, fake.Submissions())
+
+	admissions, err = fake.SubmitMany(append(jobs, jobs[0]), microbatcher.SubmitAllOrNothing)
+	assert.ErrorIs(t, err, microbatcher.ErrDuplicateJob)
+	assert.Equal(t, microbatcher.ErrSubmissionRejected, admissions[0].Err)
+	assert.Equal(t, microbatcher.ErrDuplicateJob, admissions[2].Err)
+	assert.Len(t, fake.Submissions(), 2)
+	assert.Nil(t, fake.Shutdown())
+}
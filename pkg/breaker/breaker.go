@@ -0,0 +1,185 @@
+package breaker
+
+import (
+	"fmt"
+	"log/slog"
+	"microbatcher/pkg/clock"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Counts is a snapshot of the breaker metrics.
+type Counts struct {
+	Successes   int
+	Failures    int
+	Rejections  int
+	Transitions int
+}
+
+// CircuitBreaker tracks the outcome of the most recent batches and opens once their failure ratio reaches the
+// configured threshold. After the open timeout it turns half-open and closes again after enough successful probes.
+type CircuitBreaker struct {
+	name      string
+	config    Config
+	clock     clock.Clock
+	mutex     sync.Mutex
+	state     State
+	outcomes  []bool
+	next      int
+	recorded  int
+	failures  int
+	openedAt  time.Time
+	successes int
+	counts    Counts
+}
+
+// New creates a new closed circuit breaker with the given name and config which measures time by the clock.
+func New(name string, config Config, clk clock.Clock) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:     name,
+		config:   config,
+		clock:    clk,
+		outcomes: make([]bool, config.GetWindowSize()),
+	}
+}
+
+// Allow reports whether a batch may be dispatched. An open breaker turns half-open once the open timeout elapsed.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mutex.Lock()
+	var changed func()
+	defer func() {
+		cb.mutex.Unlock()
+		if changed != nil {
+			changed()
+		}
+	}()
+
+	if cb.state == StateOpen {
+		if cb.clock.Now().Sub(cb.openedAt) < cb.config.GetOpenTimeout() {
+			cb.counts.Rejections++
+			return false
+		}
+		changed = cb.setState(StateHalfOpen)
+	}
+	return true
+}
+
+// Record records the outcome of a dispatched batch.
+func (cb *CircuitBreaker) Record(success bool) {
+	cb.mutex.Lock()
+	var changed func()
+	defer func() {
+		cb.mutex.Unlock()
+		if changed != nil {
+			changed()
+		}
+	}()
+
+	if success {
+		cb.counts.Successes++
+	} else {
+		cb.counts.Failures++
+	}
+
+	switch cb.state {
+	case StateHalfOpen:
+		if !success {
+			changed = cb.setState(StateOpen)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.config.GetHalfOpenProbes() {
+			changed = cb.setState(StateClosed)
+		}
+	case StateClosed:
+		cb.push(success)
+		if cb.recorded >= cb.config.GetMinBatches() &&
+			float64(cb.failures)/float64(cb.recorded) >= cb.config.GetFailureRatio() {
+			changed = cb.setState(StateOpen)
+		}
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() State {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.state
+}
+
+// Counts returns the current metrics of the breaker.
+func (cb *CircuitBreaker) Counts() Counts {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.counts
+}
+
+// Policy returns the policy applied to batches while the breaker is open.
+func (cb *CircuitBreaker) Policy() Policy {
+	return cb.config.GetPolicy()
+}
+
+// push adds an outcome to the sliding window and evicts the oldest one once the window is full.
+func (cb *CircuitBreaker) push(success bool) {
+	if cb.recorded == len(cb.outcomes) {
+		if !cb.outcomes[cb.next] {
+			cb.failures--
+		}
+	} else {
+		cb.recorded++
+	}
+
+	cb.outcomes[cb.next] = success
+	if !success {
+		cb.failures++
+	}
+	cb.next = (cb.next + 1) % len(cb.outcomes)
+}
+
+// setState must be called with the mutex held. It returns the notification which has to be run after unlocking,
+// so that the hook is free to call back into the breaker.
+func (cb *CircuitBreaker) setState(state State) func() {
+	from := cb.state
+	cb.state = state
+	cb.counts.Transitions++
+
+	switch state {
+	case StateOpen:
+		cb.openedAt = cb.clock.Now()
+	case StateHalfOpen:
+		cb.successes = 0
+	case StateClosed:
+		cb.next, cb.recorded, cb.failures = 0, 0, 0
+	}
+
+	return func() {
+		slog.Info(fmt.Sprintf("%s circuit breaker changes from %s to %s", cb.name, from, state))
+		if cb.config.onStateChange != nil {
+			cb.config.onStateChange(from, state)
+		}
+	}
+}
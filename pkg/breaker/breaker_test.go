@@ -0,0 +1,176 @@
+package breaker
+
+import (
+	"microbatcher/pkg/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerOpensOnFailureRatio(t *testing.T) {
+	tests := []struct {
+		name          string
+		outcomes      []bool
+		expectedState State
+	}{
+		{
+			name:          "Stays closed before min batches are recorded",
+			outcomes:      []bool{false, false},
+			expectedState: StateClosed,
+		},
+		{
+			name:          "Stays closed below the failure ratio",
+			outcomes:      []bool{true, true, false, true},
+			expectedState: StateClosed,
+		},
+		{
+			name:          "Opens when the failure ratio is reached",
+			outcomes:      []bool{true, false, true, false},
+			expectedState: StateOpen,
+		},
+		{
+			name:          "Computes the failure ratio over the window only",
+			outcomes:      []bool{false, true, true, true, true, false, false},
+			expectedState: StateOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, _ := NewCustomConfig(0.5, 3, 4, time.Minute, 1, PolicyHold)
+			cb := New("tester", config, clock.New())
+			for _, outcome := range tt.outcomes {
+				cb.Record(outcome)
+			}
+			assert.Equal(t, tt.expectedState, cb.State())
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	tests := []struct {
+		name          string
+		probes        []bool
+		expectedState State
+	}{
+		{
+			name:          "Closes after enough successful probes",
+			probes:        []bool{true, true},
+			expectedState: StateClosed,
+		},
+		{
+			name:          "Stays half-open until enough probes succeeded",
+			probes:        []bool{true},
+			expectedState: StateHalfOpen,
+		},
+		{
+			name:          "Opens again on a failed probe",
+			probes:        []bool{true, false},
+			expectedState: StateOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transitions []State
+			config, _ := NewCustomConfig(0.5, 1, 1, time.Minute, 2, PolicyHold)
+			config.SetOnStateChange(func(from, to State) {
+				transitions = append(transitions, to)
+			})
+
+			fakeClock := clock.NewFake(time.Now())
+			cb := New("tester", config, fakeClock)
+
+			cb.Record(false)
+			assert.Equal(t, StateOpen, cb.State())
+			assert.False(t, cb.Allow())
+
+			fakeClock.Advance(time.Minute)
+			assert.True(t, cb.Allow())
+			assert.Equal(t, StateHalfOpen, cb.State())
+
+			for _, probe := range tt.probes {
+				cb.Record(probe)
+			}
+			assert.Equal(t, tt.expectedState, cb.State())
+			assert.Equal(t, tt.expectedState, transitions[len(transitions)-1])
+			assert.Equal(t, len(transitions), cb.Counts().Transitions)
+			assert.Equal(t, 1, cb.Counts().Rejections)
+		})
+	}
+}
+
+func TestNewCustomConfig(t *testing.T) {
+	tests := []struct {
+		name                string
+		failureRatio        float64
+		minBatches          int
+		windowSize          int
+		openTimeout         time.Duration
+		halfOpenProbes      int
+		expectError         bool
+		expectedErrorString string
+	}{
+		{
+			name:           "Valid custom circuit breaker config",
+			failureRatio:   0.8,
+			minBatches:     5,
+			windowSize:     10,
+			openTimeout:    time.Second,
+			halfOpenProbes: 2,
+			expectError:    false,
+		},
+		{
+			name:                "Invalid failure ratio",
+			failureRatio:        1.5,
+			minBatches:          5,
+			windowSize:          10,
+			openTimeout:         time.Second,
+			halfOpenProbes:      2,
+			expectError:         true,
+			expectedErrorString: "failureRatio must be greater than 0 and at most 1",
+		},
+		{
+			name:                "Invalid zero open timeout",
+			failureRatio:        0.5,
+			minBatches:          5,
+			windowSize:          10,
+			openTimeout:         0,
+			halfOpenProbes:      2,
+			expectError:         true,
+			expectedErrorString: "minBatches, windowSize, openTimeout and halfOpenProbes must be positive",
+		},
+		{
+			name:                "Invalid min batches greater than window size",
+			failureRatio:        0.5,
+			minBatches:          20,
+			windowSize:          10,
+			openTimeout:         time.Second,
+			halfOpenProbes:      2,
+			expectError:         true,
+			expectedErrorString: "minBatches must not be greater than windowSize",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewCustomConfig(
+				tt.failureRatio, tt.minBatches, tt.windowSize, tt.openTimeout, tt.halfOpenProbes, PolicyFailFast,
+			)
+
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrorString)
+				assert.Equal(t, Config{}, config)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.failureRatio, config.GetFailureRatio())
+				assert.Equal(t, tt.minBatches, config.GetMinBatches())
+				assert.Equal(t, tt.windowSize, config.GetWindowSize())
+				assert.Equal(t, tt.openTimeout, config.GetOpenTimeout())
+				assert.Equal(t, tt.halfOpenProbes, config.GetHalfOpenProbes())
+				assert.Equal(t, PolicyFailFast, config.GetPolicy())
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package breaker
+
+import (
+	"errors"
+	"time"
+)
+
+const DEFAULT_FAILURE_RATIO = 0.5
+const DEFAULT_MIN_BATCHES = 5
+const DEFAULT_WINDOW_SIZE = 20
+const DEFAULT_OPEN_TIMEOUT_IN_SECOND = 30
+const DEFAULT_HALF_OPEN_PROBES = 1
+
+// Policy decides what the batcher does with batches while the circuit breaker is open.
+type Policy int
+
+const (
+	// PolicyHold keeps the batches pending until the breaker lets a probe through again.
+	PolicyHold Policy = iota
+	// PolicyFailFast completes the batches straight away with ErrCircuitOpen.
+	PolicyFailFast
+)
+
+func (p Policy) String() string {
+	switch p {
+	case PolicyHold:
+		return "hold"
+	case PolicyFailFast:
+		return "fail-fast"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	failureRatio   float64
+	minBatches     int
+	windowSize     int
+	openTimeout    time.Duration
+	halfOpenProbes int
+	policy         Policy
+	onStateChange  func(from, to State)
+}
+
+// NewDefaultConfig creates and returns a new circuit breaker config with default values.
+func NewDefaultConfig() Config {
+	return Config{
+		failureRatio:   DEFAULT_FAILURE_RATIO,
+		minBatches:     DEFAULT_MIN_BATCHES,
+		windowSize:     DEFAULT_WINDOW_SIZE,
+		openTimeout:    DEFAULT_OPEN_TIMEOUT_IN_SECOND * time.Second,
+		halfOpenProbes: DEFAULT_HALF_OPEN_PROBES,
+		policy:         PolicyHold,
+	}
+}
+
+// NewCustomConfig creates and returns a new circuit breaker config with custom values. The breaker opens once at
+// least minBatches of the last windowSize batches are recorded and their failure ratio reaches failureRatio.
+func NewCustomConfig(
+	failureRatio float64,
+	minBatches int,
+	windowSize int,
+	openTimeout time.Duration,
+	halfOpenProbes int,
+	policy Policy,
+) (Config, error) {
+	if failureRatio <= 0 || failureRatio > 1 {
+		return Config{}, errors.New("failureRatio must be greater than 0 and at most 1")
+	}
+
+	if minBatches < 1 || windowSize < 1 || openTimeout <= 0 || halfOpenProbes < 1 {
+		return Config{}, errors.New("minBatches, windowSize, openTimeout and halfOpenProbes must be positive")
+	}
+
+	if minBatches > windowSize {
+		return Config{}, errors.New("minBatches must not be greater than windowSize")
+	}
+
+	return Config{
+		failureRatio:   failureRatio,
+		minBatches:     minBatches,
+		windowSize:     windowSize,
+		openTimeout:    openTimeout,
+		halfOpenProbes: halfOpenProbes,
+		policy:         policy,
+	}, nil
+}
+
+// GetFailureRatio returns the batch failure ratio which opens the breaker.
+func (c *Config) GetFailureRatio() float64 {
+	return c.failureRatio
+}
+
+// GetMinBatches returns the number of recorded batches needed before the breaker can open.
+func (c *Config) GetMinBatches() int {
+	return c.minBatches
+}
+
+// GetWindowSize returns the number of most recent batches the failure ratio is computed over.
+func (c *Config) GetWindowSize() int {
+	return c.windowSize
+}
+
+// GetOpenTimeout returns how long the breaker stays open before letting probes through.
+func (c *Config) GetOpenTimeout() time.Duration {
+	return c.openTimeout
+}
+
+// GetHalfOpenProbes returns the number of successful probes needed to close the breaker again.
+func (c *Config) GetHalfOpenProbes() int {
+	return c.halfOpenProbes
+}
+
+// GetPolicy returns the policy applied to batches while the breaker is open.
+func (c *Config) GetPolicy() Policy {
+	return c.policy
+}
+
+// SetOnStateChange sets the hook which is called on every state change of the breaker.
+func (c *Config) SetOnStateChange(onStateChange func(from, to State)) {
+	c.onStateChange = onStateChange
+}
@@ -0,0 +1,49 @@
+// Package clock abstracts the time source of the batcher, so that timing can be tested deterministically.
+package clock
+
+import "time"
+
+// Clock is a source of the current time and of timers.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock. It follows the semantics of time.Timer since Go 1.23, which means that
+// after Stop or Reset returns no stale value is received from C.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type realClock struct{}
+
+// New returns the clock backed by the time package.
+func New() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (rt *realTimer) C() <-chan time.Time {
+	return rt.timer.C
+}
+
+func (rt *realTimer) Stop() bool {
+	return rt.timer.Stop()
+}
+
+func (rt *realTimer) Reset(d time.Duration) bool {
+	return rt.timer.Reset(d)
+}
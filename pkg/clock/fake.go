@@ -0,0 +1,137 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a manual clock. Time only moves by Advance, which fires every timer that becomes due.
+type Fake struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake creates a new fake clock starting at the given time.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+// Now returns the current fake time.
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.now
+}
+
+// NewTimer creates a timer which fires once the fake time is advanced by d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ft := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	ft.arm(d)
+	return ft
+}
+
+// Advance moves the fake time forward and fires the timers which become due in order of their deadline.
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.now = f.now.Add(d)
+
+	var due []*fakeTimer
+	for _, ft := range f.timers {
+		if !ft.deadline.After(f.now) {
+			due = append(due, ft)
+		}
+	}
+	sort.SliceStable(due, func(a, b int) bool {
+		return due[a].deadline.Before(due[b].deadline)
+	})
+
+	for _, ft := range due {
+		ft.disarm()
+		select {
+		case ft.c <- f.now:
+		default:
+		}
+	}
+	f.cond.Broadcast()
+}
+
+// BlockUntilTimers blocks until at least n timers are active. Tests use it to advance the time only once the
+// code under test armed its timers.
+func (f *Fake) BlockUntilTimers(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	c        chan time.Time
+	deadline time.Time
+}
+
+func (ft *fakeTimer) C() <-chan time.Time {
+	return ft.c
+}
+
+func (ft *fakeTimer) Stop() bool {
+	ft.clock.mutex.Lock()
+	defer ft.clock.mutex.Unlock()
+
+	wasActive := ft.disarm()
+	ft.drain()
+	return wasActive
+}
+
+func (ft *fakeTimer) Reset(d time.Duration) bool {
+	ft.clock.mutex.Lock()
+	defer ft.clock.mutex.Unlock()
+
+	wasActive := ft.disarm()
+	ft.drain()
+	ft.arm(d)
+	return wasActive
+}
+
+// arm must be called with the clock mutex held. A non-positive duration fires the timer straight away.
+func (ft *fakeTimer) arm(d time.Duration) {
+	ft.deadline = ft.clock.now.Add(d)
+	if d <= 0 {
+		ft.c <- ft.clock.now
+		return
+	}
+	ft.clock.timers = append(ft.clock.timers, ft)
+	ft.clock.cond.Broadcast()
+}
+
+// disarm must be called with the clock mutex held. It reports whether the timer was active.
+func (ft *fakeTimer) disarm() bool {
+	for i, active := range ft.clock.timers {
+		if active == ft {
+			ft.clock.timers = append(ft.clock.timers[:i], ft.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// drain drops a fired but not yet received value, as time.Timer does since Go 1.23.
+func (ft *fakeTimer) drain() {
+	select {
+	case <-ft.c:
+	default:
+	}
+}
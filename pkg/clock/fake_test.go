@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fired(timer Timer) bool {
+	select {
+	case <-timer.C():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	tests := []struct {
+		name          string
+		duration      time.Duration
+		advance       []time.Duration
+		expectedFired bool
+	}{
+		{
+			name:          "Timer does not fire before its deadline",
+			duration:      time.Second,
+			advance:       []time.Duration{999 * time.Millisecond},
+			expectedFired: false,
+		},
+		{
+			name:          "Timer fires at its deadline",
+			duration:      time.Second,
+			advance:       []time.Duration{500 * time.Millisecond, 500 * time.Millisecond},
+			expectedFired: true,
+		},
+		{
+			name:          "Timer with non-positive duration fires straight away",
+			duration:      0,
+			advance:       nil,
+			expectedFired: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			fake := NewFake(start)
+			timer := fake.NewTimer(tt.duration)
+
+			var elapsed time.Duration
+			for _, d := range tt.advance {
+				fake.Advance(d)
+				elapsed += d
+			}
+			assert.Equal(t, start.Add(elapsed), fake.Now())
+			assert.Equal(t, tt.expectedFired, fired(timer))
+		})
+	}
+}
+
+func TestFakeTimerStopAndReset(t *testing.T) {
+	fake := NewFake(time.Now())
+	timer := fake.NewTimer(time.Second)
+
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop())
+	fake.Advance(time.Second)
+	assert.False(t, fired(timer))
+
+	assert.False(t, timer.Reset(time.Second))
+	fake.Advance(time.Second)
+	// a reset drops the fired value which is not received yet
+	assert.False(t, timer.Reset(time.Second))
+	assert.False(t, fired(timer))
+
+	fake.Advance(time.Second)
+	assert.True(t, fired(timer))
+}
+
+func TestFakeBlockUntilTimers(t *testing.T) {
+	fake := NewFake(time.Now())
+
+	armed := make(chan Timer)
+	go func() {
+		armed <- fake.NewTimer(time.Second)
+	}()
+
+	fake.BlockUntilTimers(1)
+	fake.Advance(time.Second)
+	assert.True(t, fired(<-armed))
+}
@@ -2,6 +2,9 @@ package configs
 
 import (
 	"errors"
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/ratelimit"
 	"time"
 )
 
@@ -9,11 +12,48 @@ const DEFAULT_QUEUE_SIZE = 100
 const DEFAULT_BATCH_PROCESS_SIZE = 10
 const DEFAULT_BATCH_PROCESS_FREQUENCY_IN_MILLISECOND = 100
 const QUEUE_FACTOR = 2
+const DEFAULT_STATUS_RETENTION_JOBS = 1000
+const DEFAULT_MAX_BATCH_RETRY_AFTER_IN_SECOND = 60
+
+// BisectStrategy decides how a failed batch is split up to isolate the jobs which fail it.
+type BisectStrategy int
+
+const (
+	// BisectNone keeps failed batches as they are.
+	BisectNone BisectStrategy = iota
+	// BisectHalves processes both halves of a failed batch again, and the halves of failed halves in turn.
+	BisectHalves
+	// BisectSingles processes every job of a failed batch again on its own.
+	BisectSingles
+)
+
+func (bs BisectStrategy) String() string {
+	switch bs {
+	case BisectNone:
+		return "none"
+	case BisectHalves:
+		return "halves"
+	case BisectSingles:
+		return "singles"
+	default:
+		return "unknown"
+	}
+}
 
 type BatcherConfig struct {
 	jobQueueSize          int
 	batchProcessSize      int
 	batchProcessFrequency time.Duration
+	batchTimeout          time.Duration
+	circuitBreaker        *breaker.Config
+	rateLimit             *ratelimit.Config
+	clock                 clock.Clock
+	bisectStrategy        BisectStrategy
+	bisectMaxDepth        int
+	batchRetries          int
+	maxBatchRetryAfter    time.Duration
+	statusRetentionJobs   int
+	statusRetentionTTL    time.Duration
 }
 
 // NewDefaultConfig creates and returns a new batcher config with default values.
@@ -60,3 +100,148 @@ func (b *BatcherConfig) GetBatchProcessSize() int {
 func (b *BatcherConfig) GetBatchProcessFrequency() time.Duration {
 	return b.batchProcessFrequency
 }
+
+// GetBatchTimeout returns the maximum duration of a single batch process. Zero means no timeout.
+func (b *BatcherConfig) GetBatchTimeout() time.Duration {
+	return b.batchTimeout
+}
+
+// SetBatchTimeout sets the maximum duration of a single batch process. Zero disables the timeout. A timed out batch
+// is failed and retried under the batch retries, while the processor call is left running, i.e. a processor which
+// does not stop once its context is cancelled is called concurrently by the next batch.
+func (b *BatcherConfig) SetBatchTimeout(batchTimeout time.Duration) error {
+	if batchTimeout < 0 {
+		return errors.New("batchTimeout must not be negative")
+	}
+
+	b.batchTimeout = batchTimeout
+	return nil
+}
+
+// GetCircuitBreaker returns the circuit breaker config, or nil when the circuit breaker is disabled.
+func (b *BatcherConfig) GetCircuitBreaker() *breaker.Config {
+	return b.circuitBreaker
+}
+
+// SetCircuitBreaker enables a circuit breaker around the batch processor with the given config.
+func (b *BatcherConfig) SetCircuitBreaker(circuitBreaker breaker.Config) {
+	b.circuitBreaker = &circuitBreaker
+}
+
+// GetRateLimit returns the rate limit config, or nil when neither dispatch nor submission is rate limited.
+func (b *BatcherConfig) GetRateLimit() *ratelimit.Config {
+	return b.rateLimit
+}
+
+// SetRateLimit enables rate limits of batch dispatch and job admission with the given config.
+func (b *BatcherConfig) SetRateLimit(rateLimit ratelimit.Config) {
+	b.rateLimit = &rateLimit
+}
+
+// GetClock returns the clock measuring the batcher timing, which is the real clock unless set otherwise.
+func (b *BatcherConfig) GetClock() clock.Clock {
+	if b.clock == nil {
+		return clock.New()
+	}
+	return b.clock
+}
+
+// SetClock sets the clock measuring the batcher timing. Tests set a fake clock to advance time deterministically.
+func (b *BatcherConfig) SetClock(clk clock.Clock) {
+	b.clock = clk
+}
+
+// GetBisectStrategy returns how a failed batch is split up, which is BisectNone unless set otherwise.
+func (b *BatcherConfig) GetBisectStrategy() BisectStrategy {
+	return b.bisectStrategy
+}
+
+// GetBisectMaxDepth returns how often a failed batch is split up at most.
+func (b *BatcherConfig) GetBisectMaxDepth() int {
+	return b.bisectMaxDepth
+}
+
+// SetBisect sets how a batch whose jobs all failed is split up and processed again, so that only the jobs
+// failing on their own end up with errors. The max depth bounds how often a batch is split, e.g. a depth of 3
+// splits a batch into eighths at most. BisectSingles splits a batch only once.
+func (b *BatcherConfig) SetBisect(bisectStrategy BisectStrategy, bisectMaxDepth int) error {
+	if bisectStrategy < BisectNone || bisectStrategy > BisectSingles {
+		return errors.New("bisectStrategy is unknown")
+	}
+
+	if bisectStrategy != BisectNone && bisectMaxDepth < 1 {
+		return errors.New("bisectMaxDepth must be positive")
+	}
+
+	b.bisectStrategy = bisectStrategy
+	b.bisectMaxDepth = bisectMaxDepth
+	return nil
+}
+
+// GetBatchRetries returns how often a failed batch with a retry hint is retried at most.
+func (b *BatcherConfig) GetBatchRetries() int {
+	return b.batchRetries
+}
+
+// SetBatchRetries sets how often a batch is retried when the processor fails it as a whole with a retry hint, i.e.
+// a BatchResult with batch error and RetryAfter. The batch is retried once the hinted delay passed, unless the
+// delay exceeds the max batch retry after or the batcher shuts down in the meantime. Zero disables the retries.
+func (b *BatcherConfig) SetBatchRetries(batchRetries int) error {
+	if batchRetries < 0 {
+		return errors.New("batchRetries must not be negative")
+	}
+
+	b.batchRetries = batchRetries
+	return nil
+}
+
+// GetMaxBatchRetryAfter returns the longest retry hint for which a failed batch is retried, which is
+// DEFAULT_MAX_BATCH_RETRY_AFTER_IN_SECOND unless set otherwise.
+func (b *BatcherConfig) GetMaxBatchRetryAfter() time.Duration {
+	if b.maxBatchRetryAfter == 0 {
+		return DEFAULT_MAX_BATCH_RETRY_AFTER_IN_SECOND * time.Second
+	}
+	return b.maxBatchRetryAfter
+}
+
+// SetMaxBatchRetryAfter sets the longest retry hint for which a failed batch is retried. The execute loop waits
+// for the hinted delay, so a longer hint fails the batch instead of holding up the other jobs.
+func (b *BatcherConfig) SetMaxBatchRetryAfter(maxBatchRetryAfter time.Duration) error {
+	if maxBatchRetryAfter <= 0 {
+		return errors.New("maxBatchRetryAfter must be positive")
+	}
+
+	b.maxBatchRetryAfter = maxBatchRetryAfter
+	return nil
+}
+
+// GetStatusRetentionJobs returns how many finished jobs the status tracker keeps at most, which is
+// DEFAULT_STATUS_RETENTION_JOBS unless set otherwise.
+func (b *BatcherConfig) GetStatusRetentionJobs() int {
+	if b.statusRetentionJobs == 0 {
+		return DEFAULT_STATUS_RETENTION_JOBS
+	}
+	return b.statusRetentionJobs
+}
+
+// GetStatusRetentionTTL returns how long the status tracker keeps finished jobs. Zero means no time limit.
+func (b *BatcherConfig) GetStatusRetentionTTL() time.Duration {
+	return b.statusRetentionTTL
+}
+
+// SetStatusRetention sets how many finished jobs the status tracker keeps at most, and for how long after they
+// finished. The oldest finished jobs are forgotten first. Jobs in flight are always tracked. A zero TTL keeps
+// finished jobs until they are pushed out by newer ones.
+func (b *BatcherConfig) SetStatusRetention(statusRetentionJobs int, statusRetentionTTL time.Duration) error {
+	if statusRetentionJobs < 1 {
+		return errors.New("statusRetentionJobs must be positive")
+	}
+
+	if statusRetentionTTL < 0 {
+		return errors.New("statusRetentionTTL must not be negative")
+	}
+
+	b.statusRetentionJobs = statusRetentionJobs
+	b.statusRetentionTTL = statusRetentionTTL
+	return nil
+}
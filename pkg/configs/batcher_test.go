@@ -1,6 +1,9 @@
 package configs
 
 import (
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/ratelimit"
 	"testing"
 	"time"
 
@@ -83,3 +86,142 @@ func TestNewCustomConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestSetBatchTimeout(t *testing.T) {
+	tests := []struct {
+		name                string
+		batchTimeout        time.Duration
+		expectError         bool
+		expectedErrorString string
+	}{
+		{
+			name:         "Valid batch timeout",
+			batchTimeout: 5 * time.Second,
+			expectError:  false,
+		},
+		{
+			name:         "Zero batch timeout disables the timeout",
+			batchTimeout: 0,
+			expectError:  false,
+		},
+		{
+			name:                "Invalid negative batch timeout",
+			batchTimeout:        -1 * time.Second,
+			expectError:         true,
+			expectedErrorString: "batchTimeout must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			err := config.SetBatchTimeout(tt.batchTimeout)
+
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrorString)
+				assert.Equal(t, time.Duration(0), config.GetBatchTimeout())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.batchTimeout, config.GetBatchTimeout())
+			}
+		})
+	}
+}
+
+func TestSetCircuitBreaker(t *testing.T) {
+	config := NewDefaultConfig()
+	assert.Nil(t, config.GetCircuitBreaker())
+
+	breakerConfig, _ := breaker.NewCustomConfig(0.5, 1, 2, time.Second, 1, breaker.PolicyFailFast)
+	config.SetCircuitBreaker(breakerConfig)
+	assert.Equal(t, &breakerConfig, config.GetCircuitBreaker())
+}
+
+func TestSetRateLimit(t *testing.T) {
+	config := NewDefaultConfig()
+	assert.Nil(t, config.GetRateLimit())
+
+	rateLimitConfig, _ := ratelimit.NewCustomConfig(
+		ratelimit.Limit{Rate: 5, Burst: 1}, ratelimit.Limit{Rate: 50, Burst: 10}, ratelimit.Limit{}, ratelimit.PolicyWait,
+	)
+	config.SetRateLimit(rateLimitConfig)
+	assert.Equal(t, &rateLimitConfig, config.GetRateLimit())
+}
+
+func TestSetClock(t *testing.T) {
+	config := NewDefaultConfig()
+	assert.Equal(t, clock.New(), config.GetClock())
+
+	fakeClock := clock.NewFake(time.Now())
+	config.SetClock(fakeClock)
+	assert.Equal(t, fakeClock, config.GetClock())
+}
+
+func TestSetBisect(t *testing.T) {
+	tests := []struct {
+		name                string
+		bisectStrategy      BisectStrategy
+		bisectMaxDepth      int
+		expectedErrorString string
+	}{
+		{name: "Bisect in halves", bisectStrategy: BisectHalves, bisectMaxDepth: 3},
+		{name: "Bisect in singles", bisectStrategy: BisectSingles, bisectMaxDepth: 1},
+		{name: "No bisect without depth", bisectStrategy: BisectNone},
+		{
+			name:                "Invalid bisect by zero depth",
+			bisectStrategy:      BisectHalves,
+			expectedErrorString: "bisectMaxDepth must be positive",
+		},
+		{
+			name:                "Invalid bisect by unknown strategy",
+			bisectStrategy:      BisectStrategy(5),
+			bisectMaxDepth:      1,
+			expectedErrorString: "bisectStrategy is unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			err := config.SetBisect(tt.bisectStrategy, tt.bisectMaxDepth)
+			if tt.expectedErrorString != "" {
+				assert.EqualError(t, err, tt.expectedErrorString)
+				assert.Equal(t, BisectNone, config.GetBisectStrategy())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.bisectStrategy, config.GetBisectStrategy())
+				assert.Equal(t, tt.bisectMaxDepth, config.GetBisectMaxDepth())
+			}
+		})
+	}
+}
+
+func TestSetBatchRetries(t *testing.T) {
+	config := NewDefaultConfig()
+	assert.Equal(t, 0, config.GetBatchRetries())
+
+	assert.EqualError(t, config.SetBatchRetries(-1), "batchRetries must not be negative")
+	assert.NoError(t, config.SetBatchRetries(3))
+	assert.Equal(t, 3, config.GetBatchRetries())
+}
+
+func TestSetMaxBatchRetryAfter(t *testing.T) {
+	config := NewDefaultConfig()
+	assert.Equal(t, DEFAULT_MAX_BATCH_RETRY_AFTER_IN_SECOND*time.Second, config.GetMaxBatchRetryAfter())
+
+	assert.EqualError(t, config.SetMaxBatchRetryAfter(0), "maxBatchRetryAfter must be positive")
+	assert.NoError(t, config.SetMaxBatchRetryAfter(time.Minute*5))
+	assert.Equal(t, time.Minute*5, config.GetMaxBatchRetryAfter())
+}
+
+func TestSetStatusRetention(t *testing.T) {
+	config := NewDefaultConfig()
+	assert.Equal(t, DEFAULT_STATUS_RETENTION_JOBS, config.GetStatusRetentionJobs())
+	assert.Equal(t, time.Duration(0), config.GetStatusRetentionTTL())
+
+	assert.EqualError(t, config.SetStatusRetention(0, time.Minute), "statusRetentionJobs must be positive")
+	assert.EqualError(t, config.SetStatusRetention(10, -time.Minute), "statusRetentionTTL must not be negative")
+	assert.NoError(t, config.SetStatusRetention(10, time.Minute))
+	assert.Equal(t, 10, config.GetStatusRetentionJobs())
+	assert.Equal(t, time.Minute, config.GetStatusRetentionTTL())
+}
@@ -0,0 +1,201 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/types"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ Store[int, string] = (*FileStore[int, string])(nil)
+
+// MIN_COMPACT_RECORDS is the least number of records the file has before it is compacted.
+const MIN_COMPACT_RECORDS = 1000
+
+// fileRecord is the JSON form of one change of a key, i.e. a line of the file. The error of a result is kept as
+// its message, and a released key has no entry.
+type fileRecord[I types.JobId, T any] struct {
+	Key       string          `json:"key"`
+	Released  bool            `json:"released,omitempty"`
+	ID        I               `json:"id"`
+	Completed bool            `json:"completed"`
+	Data      T               `json:"data"`
+	Error     string          `json:"error,omitempty"`
+	Status    types.JobStatus `json:"status"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// FileStore keeps the idempotency keys in memory and appends every change to a file of JSON lines, so that the
+// completed keys survive restarts. The file is compacted to the current keys once it has twice as many records as
+// keys. Job IDs and data must be encodable as JSON, and errors of results are restored by message.
+type FileStore[I types.JobId, T any] struct {
+	*MemoryStore[I, T]
+	path    string
+	records int
+}
+
+// NewFileStore creates a new file-backed store keeping keys for the TTL. Completed keys of an existing file which
+// are unexpired by the clock are loaded, while keys which were in flight are dropped, since their jobs did not
+// survive the restart.
+func NewFileStore[I types.JobId, T any](path string, ttl time.Duration, clk clock.Clock) (*FileStore[I, T], error) {
+	memoryStore, err := NewMemoryStore[I, T](ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore[I, T]{MemoryStore: memoryStore, path: path}
+	if err := fs.load(clk.Now()); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStore[I, T]) Reserve(key string, id I, now time.Time) (Entry[I, T], bool, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.sweep(now)
+	if entry, ok := fs.entries[key]; ok && now.Before(entry.ExpiresAt) {
+		return entry, true, nil
+	}
+
+	entry := Entry[I, T]{ID: id, ExpiresAt: now.Add(fs.ttl)}
+	fs.entries[key] = entry
+	if err := fs.append(encodeRecord(key, entry)); err != nil {
+		delete(fs.entries, key)
+		return Entry[I, T]{}, false, err
+	}
+	return Entry[I, T]{}, false, nil
+}
+
+func (fs *FileStore[I, T]) Complete(key string, result *types.JobResult[I, T], now time.Time) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	entry := Entry[I, T]{ID: result.ID, Result: result, ExpiresAt: now.Add(fs.ttl)}
+	fs.entries[key] = entry
+	return fs.append(encodeRecord(key, entry))
+}
+
+func (fs *FileStore[I, T]) Release(key string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	delete(fs.entries, key)
+	return fs.append(fileRecord[I, T]{Key: key, Released: true})
+}
+
+// load replays the records of the file, if it exists already, and compacts it to the loaded keys. Expired keys
+// and keys in flight are dropped.
+func (fs *FileStore[I, T]) load(now time.Time) error {
+	file, err := os.Open(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read idempotency store: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for {
+		var record fileRecord[I, T]
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode idempotency store: %w", err)
+		}
+
+		if record.Released || !record.Completed || !now.Before(record.ExpiresAt) {
+			delete(fs.entries, record.Key)
+			continue
+		}
+		entry := Entry[I, T]{ID: record.ID, ExpiresAt: record.ExpiresAt}
+		entry.Result = &types.JobResult[I, T]{ID: record.ID, Data: record.Data, Status: record.Status}
+		if record.Error != "" {
+			entry.Result.Errors = errors.New(record.Error)
+		}
+		fs.entries[record.Key] = entry
+	}
+	return fs.compact()
+}
+
+// append writes the record at the end of the file, and compacts the file once it has twice as many records as
+// there are keys. It must be called with the mutex held.
+func (fs *FileStore[I, T]) append(record fileRecord[I, T]) error {
+	if fs.records >= max(2*len(fs.entries), MIN_COMPACT_RECORDS) {
+		return fs.compact()
+	}
+
+	content, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency store: %w", err)
+	}
+
+	file, err := os.OpenFile(fs.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	fs.records++
+	return nil
+}
+
+// compact replaces the file by the records of the current keys. It writes a temporary file first, so that a crash
+// does not leave a partial file behind. It must be called with the mutex held.
+func (fs *FileStore[I, T]) compact() error {
+	var content []byte
+	for key, entry := range fs.entries {
+		encoded, err := json.Marshal(encodeRecord(key, entry))
+		if err != nil {
+			return fmt.Errorf("failed to encode idempotency store: %w", err)
+		}
+		content = append(append(content, encoded...), '\n')
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	if err := os.Rename(temp.Name(), fs.path); err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	fs.records = len(fs.entries)
+	return nil
+}
+
+// encodeRecord returns the record of the entry of the key.
+func encodeRecord[I types.JobId, T any](key string, entry Entry[I, T]) fileRecord[I, T] {
+	record := fileRecord[I, T]{Key: key, ID: entry.ID, ExpiresAt: entry.ExpiresAt}
+	if entry.Result != nil {
+		record.Completed = true
+		record.Data = entry.Result.Data
+		record.Status = entry.Result.Status
+		if entry.Result.Errors != nil {
+			record.Error = entry.Result.Errors.Error()
+		}
+	}
+	return record
+}
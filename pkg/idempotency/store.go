@@ -0,0 +1,107 @@
+// Package idempotency provides stores of idempotency keys, which let the batcher recognize resubmitted jobs.
+package idempotency
+
+import (
+	"errors"
+	"microbatcher/pkg/types"
+	"sync"
+	"time"
+)
+
+// Entry is the state of an idempotency key. The result is nil as long as the job of the key is in flight.
+type Entry[I types.JobId, T any] struct {
+	ID        I
+	Result    *types.JobResult[I, T]
+	ExpiresAt time.Time
+}
+
+// Completed reports whether the job of the key has a result.
+func (e Entry[I, T]) Completed() bool {
+	return e.Result != nil
+}
+
+// Store keeps idempotency keys for a TTL. A key is reserved by the first submission of its job and completed
+// with its result, and both in flight and completed keys expire once their TTL passes.
+type Store[I types.JobId, T any] interface {
+	// Reserve marks the key as in flight for the job ID. When the key is known already, its entry is returned
+	// with true instead and the key is left as it is.
+	Reserve(key string, id I, now time.Time) (Entry[I, T], bool, error)
+	// Complete sets the result of the key and restarts its TTL.
+	Complete(key string, result *types.JobResult[I, T], now time.Time) error
+	// Release forgets the key, e.g. when the submission of its job is rejected.
+	Release(key string) error
+}
+
+var _ Store[int, string] = (*MemoryStore[int, string])(nil)
+
+// MemoryStore keeps the idempotency keys in memory.
+type MemoryStore[I types.JobId, T any] struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	entries   map[string]Entry[I, T]
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates a new in-memory store keeping keys for the TTL.
+func NewMemoryStore[I types.JobId, T any](ttl time.Duration) (*MemoryStore[I, T], error) {
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+
+	return &MemoryStore[I, T]{
+		ttl:     ttl,
+		entries: make(map[string]Entry[I, T]),
+	}, nil
+}
+
+func (ms *MemoryStore[I, T]) Reserve(key string, id I, now time.Time) (Entry[I, T], bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.sweep(now)
+	if entry, ok := ms.entries[key]; ok && now.Before(entry.ExpiresAt) {
+		return entry, true, nil
+	}
+
+	ms.entries[key] = Entry[I, T]{ID: id, ExpiresAt: now.Add(ms.ttl)}
+	return Entry[I, T]{}, false, nil
+}
+
+func (ms *MemoryStore[I, T]) Complete(key string, result *types.JobResult[I, T], now time.Time) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.entries[key] = Entry[I, T]{ID: result.ID, Result: result, ExpiresAt: now.Add(ms.ttl)}
+	return nil
+}
+
+func (ms *MemoryStore[I, T]) Release(key string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	delete(ms.entries, key)
+	return nil
+}
+
+// Len returns the number of stored keys, including expired keys which are not swept yet.
+func (ms *MemoryStore[I, T]) Len() int {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	return len(ms.entries)
+}
+
+// sweep removes the expired keys at most once per TTL, so that keys which are never resubmitted do not pile up.
+// It must be called with the mutex held.
+func (ms *MemoryStore[I, T]) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < ms.ttl {
+		return
+	}
+
+	for key, entry := range ms.entries {
+		if !now.Before(entry.ExpiresAt) {
+			delete(ms.entries, key)
+		}
+	}
+	ms.lastSweep = now
+}
@@ -0,0 +1,189 @@
+package idempotency
+
+import (
+	"errors"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStoreError(t *testing.T) {
+	_, err := NewMemoryStore[int, string](0)
+	assert.EqualError(t, err, "ttl must be positive")
+
+	_, err = NewFileStore[int, string](filepath.Join(t.TempDir(), "keys.json"), -time.Second, clock.New())
+	assert.EqualError(t, err, "ttl must be positive")
+}
+
+func TestStore(t *testing.T) {
+	newStores := map[string]func(t *testing.T) Store[int, string]{
+		"Memory store": func(t *testing.T) Store[int, string] {
+			store, err := NewMemoryStore[int, string](time.Minute)
+			assert.NoError(t, err)
+			return store
+		},
+		"File store": func(t *testing.T) Store[int, string] {
+			store, err := NewFileStore[int, string](filepath.Join(t.TempDir(), "keys.json"), time.Minute, clock.New())
+			assert.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range newStores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			now := time.Now()
+
+			// the first reservation takes the key
+			_, found, err := store.Reserve("key", 1, now)
+			assert.NoError(t, err)
+			assert.False(t, found)
+
+			// a resubmission finds the key in flight
+			entry, found, err := store.Reserve("key", 2, now.Add(time.Second))
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.False(t, entry.Completed())
+			assert.Equal(t, 1, entry.ID)
+
+			// a resubmission finds the result once completed
+			result := &types.JobResult[int, string]{ID: 1, Data: "done"}
+			assert.NoError(t, store.Complete("key", result, now.Add(time.Second)))
+			entry, found, err = store.Reserve("key", 2, now.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.True(t, entry.Completed())
+			assert.Equal(t, result, entry.Result)
+
+			// the key is taken again once expired
+			_, found, err = store.Reserve("key", 3, now.Add(time.Second+time.Minute))
+			assert.NoError(t, err)
+			assert.False(t, found)
+
+			// a released key is taken again straight away
+			assert.NoError(t, store.Release("key"))
+			_, found, err = store.Reserve("key", 4, now.Add(time.Second+time.Minute))
+			assert.NoError(t, err)
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store, err := NewMemoryStore[int, string](time.Minute)
+	assert.NoError(t, err)
+	now := time.Now()
+
+	for i, key := range []string{"a", "b", "c"} {
+		_, _, err := store.Reserve(key, i, now)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, store.Len())
+
+	// expired keys are swept by the next reservation
+	_, _, err = store.Reserve("d", 4, now.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestFileStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	now := time.Now()
+
+	store, err := NewFileStore[int, string](path, time.Minute, clock.New())
+	assert.NoError(t, err)
+	_, _, err = store.Reserve("succeeded", 1, now)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Complete("succeeded", &types.JobResult[int, string]{
+		ID:     1,
+		Data:   "done",
+		Status: types.JobStatusSucceeded,
+	}, now))
+	_, _, err = store.Reserve("failed", 2, now)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Complete("failed", &types.JobResult[int, string]{ID: 2, Errors: errors.New("oops")}, now))
+	_, _, err = store.Reserve("in-flight", 3, now)
+	assert.NoError(t, err)
+
+	reloaded, err := NewFileStore[int, string](path, time.Minute, clock.New())
+	assert.NoError(t, err)
+
+	entry, found, err := reloaded.Reserve("succeeded", 4, now)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, &types.JobResult[int, string]{ID: 1, Data: "done", Status: types.JobStatusSucceeded}, entry.Result)
+
+	entry, found, err = reloaded.Reserve("failed", 4, now)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.EqualError(t, entry.Result.Errors, "oops")
+
+	// the job of a key in flight did not survive the restart, so its key is free again
+	_, found, err = reloaded.Reserve("in-flight", 4, now)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	now := time.Now()
+
+	store, err := NewFileStore[int, string](path, time.Minute, clock.New())
+	assert.NoError(t, err)
+	for i := 0; i < 2*MIN_COMPACT_RECORDS; i++ {
+		_, _, err = store.Reserve("released", i, now)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Release("released"))
+	}
+	_, _, err = store.Reserve("kept", 1, now)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Complete("kept", &types.JobResult[int, string]{ID: 1, Data: "done"}, now))
+
+	// released keys are compacted away, so the file does not grow with every change
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Less(t, strings.Count(string(content), "\n"), MIN_COMPACT_RECORDS+3)
+
+	reloaded, err := NewFileStore[int, string](path, time.Minute, clock.New())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reloaded.Len())
+	entry, found, err := reloaded.Reserve("kept", 2, now)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "done", entry.Result.Data)
+}
+
+func TestFileStoreReloadExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	fakeClock := clock.NewFake(time.Now())
+
+	store, err := NewFileStore[int, string](path, time.Minute, fakeClock)
+	assert.NoError(t, err)
+	_, _, err = store.Reserve("expired", 1, fakeClock.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Complete("expired", &types.JobResult[int, string]{ID: 1}, fakeClock.Now()))
+
+	// the key is loaded until its TTL elapsed by the clock of the store
+	reloaded, err := NewFileStore[int, string](path, time.Minute, fakeClock)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reloaded.Len())
+
+	fakeClock.Advance(time.Minute)
+	reloaded, err = NewFileStore[int, string](path, time.Minute, fakeClock)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, reloaded.Len())
+}
+
+func TestFileStoreLoadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+
+	_, err := NewFileStore[int, string](path, time.Minute, clock.New())
+	assert.ErrorContains(t, err, "failed to decode idempotency store")
+}
@@ -0,0 +1,35 @@
+package ingest
+
+import (
+	"encoding/json"
+	"microbatcher/pkg/types"
+)
+
+// Codec decodes a submitted record into a job.
+type Codec[I types.JobId, T any] interface {
+	Decode(record []byte) (*types.Job[I, T], error)
+}
+
+// JSONCodec decodes JSON records of the form {"id": ..., "data": ...}, with an optional "idempotency_key".
+type JSONCodec[I types.JobId, T any] struct{}
+
+type jobJSON[I types.JobId, T any] struct {
+	ID             I      `json:"id"`
+	Data           T      `json:"data"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+func (JSONCodec[I, T]) Decode(record []byte) (*types.Job[I, T], error) {
+	var decoded jobJSON[I, T]
+	if err := json.Unmarshal(record, &decoded); err != nil {
+		return nil, err
+	}
+	return &types.Job[I, T]{ID: decoded.ID, Data: decoded.Data, IdempotencyKey: decoded.IdempotencyKey}, nil
+}
+
+// CodecFunc adapts a function to a Codec.
+type CodecFunc[I types.JobId, T any] func(record []byte) (*types.Job[I, T], error)
+
+func (f CodecFunc[I, T]) Decode(record []byte) (*types.Job[I, T], error) {
+	return f(record)
+}
@@ -0,0 +1,321 @@
+// Package ingest provides an HTTP server component which turns requests into batched jobs.
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"microbatcher"
+	"microbatcher/pkg/types"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DEFAULT_MAX_BODY_BYTES = 10 << 20
+const DEFAULT_WAIT_TIMEOUT_IN_SECOND = 30
+const NDJSON_CONTENT_TYPE = "application/x-ndjson"
+
+type jobStatusJSON struct {
+	ID     any    `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type resultJSON struct {
+	ID    any    `json:"id"`
+	Data  any    `json:"data"`
+	Error string `json:"error,omitempty"`
+}
+
+type responseJSON struct {
+	Jobs    []jobStatusJSON `json:"jobs"`
+	Results []resultJSON    `json:"results,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Server accepts job submissions over HTTP and submits them to a batcher. A POST request carries either a single
+// record, or one record per line with the NDJSON content type. Records are decoded into jobs by the codec.
+//
+// The server responds 202 with the job IDs once the jobs are accepted. With ?wait=true it responds 200 once the
+// results of all accepted jobs are recorded instead, or 504 when the wait timeout is exceeded first. Rejections
+// are mapped to 429 when the job queue is full or the rate limit is exceeded, to 503 when the batcher is not
+// started, and to 400 when a job ID occurs twice in the request. A bulk submission is submitted at once in
+// best-effort mode, so the accepted jobs are still processed regardless of the rejected ones.
+type Server[I types.JobId, T any] struct {
+	batcher      microbatcher.Batcher[I, T]
+	codec        Codec[I, T]
+	maxBodyBytes int64
+	waitTimeout  time.Duration
+}
+
+// NewServer creates a new ingestion server for the batcher with default body limit and wait timeout.
+func NewServer[I types.JobId, T any](batcher microbatcher.Batcher[I, T], codec Codec[I, T]) *Server[I, T] {
+	return &Server[I, T]{
+		batcher:      batcher,
+		codec:        codec,
+		maxBodyBytes: DEFAULT_MAX_BODY_BYTES,
+		waitTimeout:  DEFAULT_WAIT_TIMEOUT_IN_SECOND * time.Second,
+	}
+}
+
+// SetMaxBodyBytes sets the maximum size of a request body.
+func (s *Server[I, T]) SetMaxBodyBytes(maxBodyBytes int64) {
+	s.maxBodyBytes = maxBodyBytes
+}
+
+// SetWaitTimeout sets how long a request with ?wait=true waits for the results.
+func (s *Server[I, T]) SetWaitTimeout(waitTimeout time.Duration) {
+	s.waitTimeout = waitTimeout
+}
+
+func (s *Server[I, T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, responseJSON{Error: "method not allowed"})
+		return
+	}
+
+	jobs, err := s.decode(w, r)
+	if err != nil {
+		status := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, responseJSON{Error: err.Error()})
+		return
+	}
+
+	var collector *collector[I, T]
+	if r.URL.Query().Get("wait") == "true" {
+		// subscribe before submitting, so that no result is missed
+		collector = newCollector[I, T]()
+		defer s.batcher.Subscribe(collector.collect)()
+	}
+
+	// expect the results before submitting, since they may be recorded before SubmitMany returns
+	if collector != nil {
+		for _, job := range jobs {
+			collector.expect(job.ID, 1)
+		}
+	}
+
+	admissions, _ := s.batcher.SubmitMany(jobs, microbatcher.SubmitBestEffort)
+	response := responseJSON{Jobs: make([]jobStatusJSON, 0, len(jobs))}
+	status := http.StatusAccepted
+	for _, admission := range admissions {
+		if !admission.Accepted() {
+			if collector != nil {
+				collector.expect(admission.ID, -1)
+			}
+			response.Jobs = append(response.Jobs, jobStatusJSON{
+				ID:     admission.ID,
+				Status: "rejected",
+				Error:  admission.Err.Error(),
+			})
+			if status == http.StatusAccepted {
+				status = statusOf(admission.Err)
+			}
+			continue
+		}
+		if collector != nil {
+			s.expectResubmitted(collector, admission)
+		}
+		response.Jobs = append(response.Jobs, jobStatusJSON{ID: admission.ID, Status: "accepted"})
+	}
+
+	if collector == nil || status != http.StatusAccepted {
+		writeJSON(w, status, response)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.waitTimeout)
+	defer cancel()
+
+	results, err := collector.wait(ctx)
+	for _, result := range results {
+		encoded := resultJSON{ID: result.ID, Data: result.Data}
+		if result.Errors != nil {
+			encoded.Error = result.Errors.Error()
+		}
+		response.Results = append(response.Results, encoded)
+	}
+	if err != nil {
+		response.Error = "timed out waiting for results"
+		writeJSON(w, http.StatusGatewayTimeout, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// expectResubmitted handles an accepted job whose idempotency key is known already. Its result is recorded under
+// the ID the key was first submitted with, which may differ from the ID of the job, so the expectation is moved to
+// that ID. A result which is recorded already is collected straight away, since it is not recorded again.
+func (s *Server[I, T]) expectResubmitted(collector *collector[I, T], admission microbatcher.Admission[I, T]) {
+	result := admission.Result
+	if result == nil {
+		return
+	}
+
+	if result.ID != admission.ID {
+		collector.expect(admission.ID, -1)
+		collector.expect(result.ID, 1)
+		// the result may be recorded before the expectation is moved
+		if status, ok := s.batcher.Status(result.ID); ok && status.Status.Done() {
+			result = status
+		}
+	}
+	if result.Status.Done() {
+		collector.collect([]*types.JobResult[I, T]{result})
+	}
+}
+
+// decode decodes the records of the request body, which are one per line for NDJSON. A body beyond the max body
+// size fails with an *http.MaxBytesError.
+func (s *Server[I, T]) decode(w http.ResponseWriter, r *http.Request) ([]*types.Job[I, T], error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != NDJSON_CONTENT_TYPE {
+		job, decodeErr := s.codec.Decode(body)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("failed to decode record: %w", decodeErr)
+		}
+		return []*types.Job[I, T]{job}, nil
+	}
+
+	var jobs []*types.Job[I, T]
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, int(s.maxBodyBytes))
+	for line := 1; scanner.Scan(); line++ {
+		record := bytes.TrimSpace(scanner.Bytes())
+		if len(record) == 0 {
+			continue
+		}
+
+		job, decodeErr := s.codec.Decode(record)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("failed to decode record on line %d: %w", line, decodeErr)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	if len(jobs) == 0 {
+		return nil, errors.New("no records in body")
+	}
+	return jobs, nil
+}
+
+// statusOf maps a submission error to the HTTP status of the response.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, microbatcher.ErrQueueFull), errors.Is(err, microbatcher.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, microbatcher.ErrNotStarted):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, microbatcher.ErrDuplicateJob):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// collector collects the results of the accepted jobs of one request.
+type collector[I types.JobId, T any] struct {
+	mutex    sync.Mutex
+	expected map[I]int
+	results  []*types.JobResult[I, T]
+	done     chan struct{}
+	waiting  bool
+	closed   bool
+}
+
+func newCollector[I types.JobId, T any]() *collector[I, T] {
+	return &collector[I, T]{
+		expected: make(map[I]int),
+		done:     make(chan struct{}),
+	}
+}
+
+// expect adjusts the number of results expected for the job ID.
+func (c *collector[I, T]) expect(id I, delta int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expected[id] += delta
+}
+
+// collect is the subscriber of the batcher. It is called from the batch process goroutine and must not block.
+// It also takes the results of resubmitted jobs, which the batcher returns on submission instead.
+func (c *collector[I, T]) collect(results []*types.JobResult[I, T]) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, result := range results {
+		if c.expected[result.ID] > 0 {
+			c.expected[result.ID]--
+			c.results = append(c.results, result)
+		}
+	}
+	c.closeIfComplete()
+}
+
+// wait blocks until the results of all expected jobs are collected or the context is done. The results collected
+// so far are returned in either case.
+func (c *collector[I, T]) wait(ctx context.Context) ([]*types.JobResult[I, T], error) {
+	c.mutex.Lock()
+	c.waiting = true
+	c.closeIfComplete()
+	c.mutex.Unlock()
+
+	var err error
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	results := make([]*types.JobResult[I, T], len(c.results))
+	copy(results, c.results)
+	return results, err
+}
+
+// closeIfComplete must be called with the mutex held. Nothing is complete before all jobs are submitted, which
+// is when the collector starts waiting.
+func (c *collector[I, T]) closeIfComplete() {
+	if !c.waiting || c.closed {
+		return
+	}
+
+	for _, remaining := range c.expected {
+		if remaining > 0 {
+			return
+		}
+	}
+	c.closed = true
+	close(c.done)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error(fmt.Sprintf("ingest fails to write response: %s", err))
+	}
+}
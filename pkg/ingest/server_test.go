@@ -0,0 +1,282 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"microbatcher"
+	"microbatcher/pkg/batchertest"
+	"microbatcher/pkg/configs"
+	"microbatcher/pkg/idempotency"
+	"microbatcher/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func post(t *testing.T, url string, contentType string, body string) (int, responseJSON) {
+	resp, err := http.Post(url, contentType, strings.NewReader(body))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	var decoded responseJSON
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&decoded))
+	return resp.StatusCode, decoded
+}
+
+func TestServerSubmit(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		maxBodyBytes   int64
+		submitErr      error
+		expectedStatus int
+		expectedJobs   []jobStatusJSON
+		expectedError  string
+	}{
+		{
+			name:           "Single record is accepted",
+			contentType:    "application/json",
+			body:           `{"id": 1, "data": "one"}`,
+			expectedStatus: http.StatusAccepted,
+			expectedJobs:   []jobStatusJSON{{ID: float64(1), Status: "accepted"}},
+		},
+		{
+			name:           "Bulk NDJSON records are accepted",
+			contentType:    NDJSON_CONTENT_TYPE,
+			body:           "{\"id\": 1, \"data\": \"one\"}\n\n{\"id\": 2, \"data\": \"two\"}\n",
+			expectedStatus: http.StatusAccepted,
+			expectedJobs: []jobStatusJSON{
+				{ID: float64(1), Status: "accepted"},
+				{ID: float64(2), Status: "accepted"},
+			},
+		},
+		{
+			name:           "Full job queue is mapped to too many requests",
+			contentType:    "application/json",
+			body:           `{"id": 1, "data": "one"}`,
+			submitErr:      microbatcher.ErrQueueFull,
+			expectedStatus: http.StatusTooManyRequests,
+			expectedJobs:   []jobStatusJSON{{ID: float64(1), Status: "rejected", Error: "job queue is full"}},
+		},
+		{
+			name:           "Batcher which is not started is mapped to service unavailable",
+			contentType:    "application/json",
+			body:           `{"id": 1, "data": "one"}`,
+			submitErr:      microbatcher.ErrNotStarted,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedJobs: []jobStatusJSON{
+				{ID: float64(1), Status: "rejected", Error: "invalid submission since batcher is not started"},
+			},
+		},
+		{
+			name:           "Duplicated record is a bad request",
+			contentType:    NDJSON_CONTENT_TYPE,
+			body:           "{\"id\": 1, \"data\": \"one\"}\n{\"id\": 1, \"data\": \"two\"}\n",
+			expectedStatus: http.StatusBadRequest,
+			expectedJobs: []jobStatusJSON{
+				{ID: float64(1), Status: "accepted"},
+				{ID: float64(1), Status: "rejected", Error: "job id is submitted twice"},
+			},
+		},
+		{
+			name:           "Malformed record is a bad request",
+			contentType:    NDJSON_CONTENT_TYPE,
+			body:           "{\"id\": 1, \"data\": \"one\"}\n{\"id\": 2,",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "failed to decode record on line 2: unexpected end of JSON input",
+		},
+		{
+			name:           "Body beyond the max body size is too large",
+			contentType:    NDJSON_CONTENT_TYPE,
+			body:           "{\"id\": 1, \"data\": \"one\"}\n{\"id\": 2, \"data\": \"two\"}\n",
+			maxBodyBytes:   32,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  "failed to read body: http: request body too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := batchertest.NewFake[int, string]()
+			assert.Nil(t, fake.Start())
+			fake.SetSubmitError(tt.submitErr)
+
+			handler := NewServer[int, string](fake, JSONCodec[int, string]{})
+			if tt.maxBodyBytes > 0 {
+				handler.SetMaxBodyBytes(tt.maxBodyBytes)
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			status, response := post(t, server.URL, tt.contentType, tt.body)
+			assert.Equal(t, tt.expectedStatus, status)
+			assert.Equal(t, tt.expectedError, response.Error)
+			if tt.expectedJobs != nil {
+				assert.Equal(t, tt.expectedJobs, response.Jobs)
+			}
+		})
+	}
+}
+
+func TestServerSubmitAndWait(t *testing.T) {
+	tests := []struct {
+		name            string
+		processFunc     func(job *types.Job[int, string]) *types.JobResult[int, string]
+		expectedStatus  int
+		expectedResults []resultJSON
+	}{
+		{
+			name: "Waits for the results of all jobs",
+			processFunc: func(job *types.Job[int, string]) *types.JobResult[int, string] {
+				if job.ID == 2 {
+					return &types.JobResult[int, string]{ID: job.ID, Errors: errors.New("poison job")}
+				}
+				return &types.JobResult[int, string]{ID: job.ID, Data: "processed " + job.Data}
+			},
+			expectedStatus: http.StatusOK,
+			expectedResults: []resultJSON{
+				{ID: float64(1), Data: "processed one"},
+				{ID: float64(2), Data: "", Error: "poison job"},
+			},
+		},
+		{
+			name: "Times out waiting for dropped jobs",
+			processFunc: func(job *types.Job[int, string]) *types.JobResult[int, string] {
+				if job.ID == 2 {
+					return nil
+				}
+				return &types.JobResult[int, string]{ID: job.ID, Data: "processed " + job.Data}
+			},
+			expectedStatus:  http.StatusGatewayTimeout,
+			expectedResults: []resultJSON{{ID: float64(1), Data: "processed one"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := batchertest.NewFake[int, string]()
+			fake.SetProcessFunc(tt.processFunc)
+			assert.Nil(t, fake.Start())
+
+			ingest := NewServer[int, string](fake, JSONCodec[int, string]{})
+			ingest.SetWaitTimeout(100 * time.Millisecond)
+			server := httptest.NewServer(ingest)
+			defer server.Close()
+
+			status, response := post(t, server.URL+"?wait=true", NDJSON_CONTENT_TYPE,
+				"{\"id\": 1, \"data\": \"one\"}\n{\"id\": 2, \"data\": \"two\"}")
+			assert.Equal(t, tt.expectedStatus, status)
+			assert.Equal(t, tt.expectedResults, response.Results)
+		})
+	}
+}
+
+type testingProcessor struct{}
+
+func (testingProcessor) Process(jobs []*types.Job[int, string]) []*types.JobResult[int, string] {
+	results := make([]*types.JobResult[int, string], 0, len(jobs))
+	for _, job := range jobs {
+		results = append(results, &types.JobResult[int, string]{ID: job.ID, Data: "processed " + job.Data})
+	}
+	return results
+}
+
+func TestServerSubmitAndWaitResubmission(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, 10*time.Millisecond)
+	mb := microbatcher.NewMicroBatcher[int, string]("tester", testingProcessor{}, cfg)
+	store, _ := idempotency.NewMemoryStore[int, string](time.Minute)
+	assert.Nil(t, mb.SetIdempotencyStore(store))
+	assert.Nil(t, mb.Start())
+	defer mb.Shutdown()
+
+	ingest := NewServer[int, string](mb, JSONCodec[int, string]{})
+	ingest.SetWaitTimeout(time.Second)
+	server := httptest.NewServer(ingest)
+	defer server.Close()
+
+	status, response := post(t, server.URL+"?wait=true", NDJSON_CONTENT_TYPE, "{\"id\": 1, \"data\": \"one\"}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []resultJSON{{ID: float64(1), Data: "processed one"}}, response.Results)
+
+	// the completed job is not processed again, so its result is taken from the submission
+	status, response = post(t, server.URL+"?wait=true", NDJSON_CONTENT_TYPE,
+		"{\"id\": 1, \"data\": \"one\"}\n{\"id\": 2, \"data\": \"two\"}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.ElementsMatch(t, []resultJSON{
+		{ID: float64(1), Data: "processed one"},
+		{ID: float64(2), Data: "processed two"},
+	}, response.Results)
+}
+
+func TestServerSubmitAndWaitIdempotencyKey(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(10, 5, 10*time.Millisecond)
+	mb := microbatcher.NewMicroBatcher[int, string]("tester", testingProcessor{}, cfg)
+	store, _ := idempotency.NewMemoryStore[int, string](time.Minute)
+	assert.Nil(t, mb.SetIdempotencyStore(store))
+	assert.Nil(t, mb.Start())
+	defer mb.Shutdown()
+
+	ingest := NewServer[int, string](mb, JSONCodec[int, string]{})
+	ingest.SetWaitTimeout(time.Second)
+	server := httptest.NewServer(ingest)
+	defer server.Close()
+
+	status, response := post(t, server.URL+"?wait=true", NDJSON_CONTENT_TYPE,
+		"{\"id\": 1, \"data\": \"one\", \"idempotency_key\": \"key\"}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []resultJSON{{ID: float64(1), Data: "processed one"}}, response.Results)
+
+	// the same key with a new ID responds with the result of the job the key was first submitted with
+	status, response = post(t, server.URL+"?wait=true", NDJSON_CONTENT_TYPE,
+		"{\"id\": 2, \"data\": \"one\", \"idempotency_key\": \"key\"}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []resultJSON{{ID: float64(1), Data: "processed one"}}, response.Results)
+}
+
+type requestRecord struct {
+	RequestId string `json:"request_id"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+}
+
+func TestServerWithCustomCodec(t *testing.T) {
+	codec := CodecFunc[string, string](func(record []byte) (*types.Job[string, string], error) {
+		var decoded requestRecord
+		if err := json.Unmarshal(record, &decoded); err != nil {
+			return nil, err
+		}
+		return &types.Job[string, string]{ID: decoded.RequestId, Data: decoded.Title}, nil
+	})
+
+	fake := batchertest.NewFake[string, string]()
+	assert.Nil(t, fake.Start())
+	server := httptest.NewServer(NewServer[string, string](fake, codec))
+	defer server.Close()
+
+	status, _ := post(t, server.URL, NDJSON_CONTENT_TYPE+"; charset=utf-8",
+		`{"request_id": "user-001", "title": "First", "body": "..."}`+"\n"+
+			`{"request_id": "user-002", "title": "Second", "body": "..."}`)
+	assert.Equal(t, http.StatusAccepted, status)
+
+	submissions := fake.Submissions()
+	assert.Len(t, submissions, 2)
+	assert.Equal(t, "user-002", submissions[1].ID)
+	assert.Equal(t, "Second", submissions[1].Data)
+}
+
+func TestServerMethodNotAllowed(t *testing.T) {
+	fake := batchertest.NewFake[int, string]()
+	server := httptest.NewServer(NewServer[int, string](fake, JSONCodec[int, string]{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, http.MethodPost, resp.Header.Get("Allow"))
+}
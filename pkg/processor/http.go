@@ -0,0 +1,278 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/types"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const DEFAULT_HTTP_RETRIES = 3
+const DEFAULT_MAX_RETRY_AFTER_IN_SECOND = 60
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// StatusError is the error of a batch whose response has an unexpected status code. RetryAfter is set from the
+// Retry-After header, when the server sent one.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (se *StatusError) Error() string {
+	if se.RetryAfter > 0 {
+		return fmt.Sprintf("unexpected status %d, retry after %s", se.StatusCode, se.RetryAfter)
+	}
+	return fmt.Sprintf("unexpected status %d", se.StatusCode)
+}
+
+// RequestMapper encodes the jobs of a batch into a request body.
+type RequestMapper[I types.JobId, T any] func(jobs []*types.Job[I, T]) ([]byte, error)
+
+// ResponseMapper maps a response to the results of the batch. An error fails the whole batch, whereas errors of
+// individual jobs are set on their results.
+type ResponseMapper[I types.JobId, T any] func(
+	jobs []*types.Job[I, T],
+	statusCode int,
+	body []byte,
+) ([]*types.JobResult[I, T], error)
+
+// JSONRequestMapper encodes the batch as JSON array of {"id": ..., "data": ...}.
+func JSONRequestMapper[I types.JobId, T any](jobs []*types.Job[I, T]) ([]byte, error) {
+	return json.Marshal(toWireJobs(jobs))
+}
+
+// JSONResponseMapper decodes a 2xx response as JSON array of {"id": ..., "data": ..., "error": ...}. Other status
+// codes fail the whole batch with a StatusError.
+func JSONResponseMapper[I types.JobId, T any](
+	jobs []*types.Job[I, T],
+	statusCode int,
+	body []byte,
+) ([]*types.JobResult[I, T], error) {
+	if statusCode/100 != 2 {
+		return nil, &StatusError{StatusCode: statusCode}
+	}
+
+	var decoded []wireResult[I, T]
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, fmt.Errorf("malformed response: %w", err)
+	}
+	return fromWireResults(jobs, decoded), nil
+}
+
+// HTTPProcessor posts every batch to a URL and maps the response back to the results of the batch. By default the
+// batch is sent and received as JSON, which can be changed by the request and response mappers.
+//
+// Responses with 429 or 503 status are retried after the delay of their Retry-After header, as long as retries
+// are left and the delay does not exceed the maximum. Otherwise, the last response is mapped to the results. As
+// BatchResultProcessor, it reports a failed mapping as batch error together with the request ID of the response,
+// and with the Retry-After delay as retry hint unless it retried the batch itself already.
+type HTTPProcessor[I types.JobId, T any] struct {
+	name           string
+	url            string
+	client         *http.Client
+	header         http.Header
+	requestMapper  RequestMapper[I, T]
+	responseMapper ResponseMapper[I, T]
+	retries        int
+	maxRetryAfter  time.Duration
+	clock          clock.Clock
+}
+
+// NewHTTPProcessor creates a new HTTP processor posting to the URL with the JSON mappers and default retries.
+func NewHTTPProcessor[I types.JobId, T any](name string, rawURL string) (*HTTPProcessor[I, T], error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.New("url must be an absolute http or https URL")
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return &HTTPProcessor[I, T]{
+		name:           name,
+		url:            rawURL,
+		client:         http.DefaultClient,
+		header:         header,
+		requestMapper:  JSONRequestMapper[I, T],
+		responseMapper: JSONResponseMapper[I, T],
+		retries:        DEFAULT_HTTP_RETRIES,
+		maxRetryAfter:  DEFAULT_MAX_RETRY_AFTER_IN_SECOND * time.Second,
+		clock:          clock.New(),
+	}, nil
+}
+
+// SetClient sets the client sending the requests.
+func (hp *HTTPProcessor[I, T]) SetClient(client *http.Client) {
+	hp.client = client
+}
+
+// SetHeader sets a header of every request, e.g. to authenticate or to change the content type.
+func (hp *HTTPProcessor[I, T]) SetHeader(key string, value string) {
+	hp.header.Set(key, value)
+}
+
+// SetRequestMapper sets how the jobs of a batch are encoded into a request body.
+func (hp *HTTPProcessor[I, T]) SetRequestMapper(requestMapper RequestMapper[I, T]) {
+	hp.requestMapper = requestMapper
+}
+
+// SetResponseMapper sets how a response is mapped to the results of a batch.
+func (hp *HTTPProcessor[I, T]) SetResponseMapper(responseMapper ResponseMapper[I, T]) {
+	hp.responseMapper = responseMapper
+}
+
+// SetRetries sets how often a batch is retried after a Retry-After response. Zero disables retries.
+func (hp *HTTPProcessor[I, T]) SetRetries(retries int) error {
+	if retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+
+	hp.retries = retries
+	return nil
+}
+
+// SetMaxRetryAfter sets the longest Retry-After delay which is waited for before retrying a batch.
+func (hp *HTTPProcessor[I, T]) SetMaxRetryAfter(maxRetryAfter time.Duration) error {
+	if maxRetryAfter < 0 {
+		return errors.New("maxRetryAfter must not be negative")
+	}
+
+	hp.maxRetryAfter = maxRetryAfter
+	return nil
+}
+
+// SetClock sets the clock which Retry-After delays are waited by.
+func (hp *HTTPProcessor[I, T]) SetClock(clk clock.Clock) {
+	hp.clock = clk
+}
+
+func (hp *HTTPProcessor[I, T]) Process(jobs []*types.Job[I, T]) []*types.JobResult[I, T] {
+	return hp.ProcessContext(context.Background(), jobs)
+}
+
+func (hp *HTTPProcessor[I, T]) ProcessContext(ctx context.Context, jobs []*types.Job[I, T]) []*types.JobResult[I, T] {
+	return hp.ProcessBatch(ctx, jobs).Results
+}
+
+func (hp *HTTPProcessor[I, T]) ProcessBatch(ctx context.Context, jobs []*types.Job[I, T]) *types.BatchResult[I, T] {
+	body, err := hp.requestMapper(jobs)
+	if err != nil {
+		return failBatch(jobs, fmt.Errorf("failed to encode request: %w", err))
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, postErr := hp.post(ctx, body)
+		if postErr != nil {
+			slog.Error(fmt.Sprintf("%s fails to post batch: %s", hp.name, postErr))
+			return failBatch(jobs, postErr)
+		}
+
+		retryAfter := response.retryAfter
+		retryable := response.statusCode == http.StatusTooManyRequests ||
+			response.statusCode == http.StatusServiceUnavailable
+		if retryable && retryAfter >= 0 && retryAfter <= hp.maxRetryAfter && attempt < hp.retries {
+			slog.Info(fmt.Sprintf("%s receives status %d, retries batch after %s", hp.name, response.statusCode, retryAfter))
+			if waitErr := hp.wait(ctx, retryAfter); waitErr != nil {
+				return failBatch(jobs, waitErr)
+			}
+			continue
+		}
+
+		results, mapErr := hp.responseMapper(jobs, response.statusCode, response.body)
+		if mapErr != nil {
+			var statusErr *StatusError
+			if errors.As(mapErr, &statusErr) && retryAfter > 0 {
+				statusErr.RetryAfter = retryAfter
+			}
+			slog.Error(fmt.Sprintf("%s fails to map response: %s", hp.name, mapErr))
+			batchResult := failBatch(jobs, mapErr)
+			batchResult.RequestID = response.requestID
+			// the batcher retries on the hint only, when the processor did not retry the batch itself
+			if attempt == 0 {
+				batchResult.RetryAfter = max(retryAfter, 0)
+			}
+			return batchResult
+		}
+		return &types.BatchResult[I, T]{Results: results, RequestID: response.requestID}
+	}
+}
+
+func failBatch[I types.JobId, T any](jobs []*types.Job[I, T], err error) *types.BatchResult[I, T] {
+	return &types.BatchResult[I, T]{Results: failJobs(jobs, err), Error: err}
+}
+
+// httpResponse is a read response with the Retry-After delay, which is negative without header.
+type httpResponse struct {
+	statusCode int
+	retryAfter time.Duration
+	requestID  string
+	body       []byte
+}
+
+// post sends the batch and reads the response.
+func (hp *HTTPProcessor[I, T]) post(ctx context.Context, body []byte) (*httpResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hp.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = hp.header.Clone()
+
+	resp, err := hp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return &httpResponse{
+		statusCode: resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), hp.clock.Now()),
+		requestID:  resp.Header.Get(REQUEST_ID_HEADER),
+		body:       responseBody,
+	}, nil
+}
+
+func (hp *HTTPProcessor[I, T]) wait(ctx context.Context, d time.Duration) error {
+	timer := hp.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as HTTP date. It returns -1 without valid header.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return -1
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return -1
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return -1
+}
@@ -0,0 +1,347 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newEchoHandler returns a handler which echoes every job as its result, failing jobs with data "fail".
+func newEchoHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var jobs []wireJob[int, string]
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&jobs))
+		results := make([]wireResult[int, string], 0, len(jobs))
+		for _, job := range jobs {
+			result := wireResult[int, string]{ID: job.ID, Data: strings.ToUpper(job.Data)}
+			if job.Data == "fail" {
+				result.Error = "failed " + job.Data
+			}
+			results = append(results, result)
+		}
+		_ = json.NewEncoder(w).Encode(results)
+	}
+}
+
+func newTestingHTTPProcessor(t *testing.T, handler http.Handler) *HTTPProcessor[int, string] {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	hp, err := NewHTTPProcessor[int, string]("test", server.URL)
+	assert.NoError(t, err)
+	return hp
+}
+
+func TestNewHTTPProcessor(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedError string
+	}{
+		{name: "HTTP URL", url: "http://localhost:8080/batches"},
+		{name: "HTTPS URL", url: "https://example.com"},
+		{name: "Relative URL", url: "/batches", expectedError: "url must be an absolute http or https URL"},
+		{name: "Other scheme", url: "ftp://example.com", expectedError: "url must be an absolute http or https URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHTTPProcessor[int, string]("test", tt.url)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestHTTPProcessorProcess(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		data          []string
+		expectedData  []string
+		expectedError []string
+	}{
+		{
+			name:          "Results are mapped per job",
+			handler:       newEchoHandler(t),
+			data:          []string{"a", "fail"},
+			expectedData:  []string{"A", "FAIL"},
+			expectedError: []string{"", "failed fail"},
+		},
+		{
+			name: "Missing result fails its job",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`[{"id":1,"data":"A"}]`))
+			},
+			data:          []string{"a", "b"},
+			expectedData:  []string{"A", ""},
+			expectedError: []string{"", "no result for job 2"},
+		},
+		{
+			name: "Unexpected status fails the batch",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			data:          []string{"a", "b"},
+			expectedData:  []string{"", ""},
+			expectedError: []string{"unexpected status 400", "unexpected status 400"},
+		},
+		{
+			name: "Malformed response fails the batch",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("oops"))
+			},
+			data:         []string{"a"},
+			expectedData: []string{""},
+			expectedError: []string{
+				"malformed response: invalid character 'o' looking for beginning of value",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hp := newTestingHTTPProcessor(t, tt.handler)
+			results := hp.Process(testingJobs(tt.data...))
+
+			assert.Len(t, results, len(tt.data))
+			for i, result := range results {
+				assert.Equal(t, i+1, result.ID)
+				assert.Equal(t, tt.expectedData[i], result.Data)
+				if tt.expectedError == nil || tt.expectedError[i] == "" {
+					assert.NoError(t, result.Errors)
+				} else {
+					assert.EqualError(t, result.Errors, tt.expectedError[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPProcessorMappers(t *testing.T) {
+	hp := newTestingHTTPProcessor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/plain", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(strings.ToUpper(string(body))))
+	}))
+	hp.SetHeader("Content-Type", "text/plain")
+	hp.SetHeader("Authorization", "Bearer token")
+	hp.SetRequestMapper(func(jobs []*types.Job[int, string]) ([]byte, error) {
+		data := make([]string, 0, len(jobs))
+		for _, job := range jobs {
+			data = append(data, job.Data)
+		}
+		return []byte(strings.Join(data, ",")), nil
+	})
+	// 422 responses reject the jobs individually
+	hp.SetResponseMapper(func(
+		jobs []*types.Job[int, string],
+		statusCode int,
+		body []byte,
+	) ([]*types.JobResult[int, string], error) {
+		results := make([]*types.JobResult[int, string], 0, len(jobs))
+		for i, data := range strings.Split(string(body), ",") {
+			results = append(results, &types.JobResult[int, string]{
+				ID:     jobs[i].ID,
+				Errors: fmt.Errorf("status %d: %s", statusCode, data),
+			})
+		}
+		return results, nil
+	})
+
+	results := hp.Process(testingJobs("a", "b"))
+	assert.Len(t, results, 2)
+	assert.EqualError(t, results[0].Errors, "status 422: A")
+	assert.EqualError(t, results[1].Errors, "status 422: B")
+}
+
+func TestHTTPProcessorRetryAfter(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryAfter    string
+		throttled     int32
+		expectedError error
+	}{
+		{
+			name:       "Retried after throttling",
+			retryAfter: "2",
+			throttled:  2,
+		},
+		{
+			name:          "Failed once retries are exhausted",
+			retryAfter:    "2",
+			throttled:     4,
+			expectedError: &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Second},
+		},
+		{
+			name:          "Failed without waiting beyond the maximum",
+			retryAfter:    "3600",
+			throttled:     1,
+			expectedError: &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour},
+		},
+		{
+			name:          "Failed without Retry-After",
+			throttled:     1,
+			expectedError: &StatusError{StatusCode: http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			echo := newEchoHandler(t)
+			hp := newTestingHTTPProcessor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.throttled {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				echo(w, r)
+			}))
+			fakeClock := clock.NewFake(time.Now())
+			hp.SetClock(fakeClock)
+
+			done := make(chan []*types.JobResult[int, string])
+			go func() {
+				done <- hp.Process(testingJobs("a"))
+			}()
+
+			var results []*types.JobResult[int, string]
+			for results == nil {
+				select {
+				case results = <-done:
+				case <-time.After(10 * time.Millisecond):
+					fakeClock.Advance(2 * time.Second)
+				}
+			}
+
+			assert.Len(t, results, 1)
+			if tt.expectedError == nil {
+				assert.NoError(t, results[0].Errors)
+				assert.Equal(t, "A", results[0].Data)
+			} else {
+				assert.Equal(t, tt.expectedError, results[0].Errors)
+			}
+		})
+	}
+}
+
+func TestHTTPProcessorContext(t *testing.T) {
+	hp := newTestingHTTPProcessor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	hp.SetClock(clock.NewFake(time.Now()))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	results := hp.ProcessContext(ctx, testingJobs("a"))
+	assert.True(t, errors.Is(results[0].Errors, context.DeadlineExceeded))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "Seconds", value: "120", expected: 2 * time.Minute},
+		{name: "HTTP date", value: "Mon, 01 Jan 2024 00:00:30 GMT", expected: 30 * time.Second},
+		{name: "HTTP date in the past", value: "Sun, 31 Dec 2023 23:00:00 GMT", expected: 0},
+		{name: "Missing", value: "", expected: -1},
+		{name: "Negative", value: "-1", expected: -1},
+		{name: "Invalid", value: "soon", expected: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseRetryAfter(tt.value, now))
+		})
+	}
+}
+
+func TestHTTPProcessorProcessBatch(t *testing.T) {
+	tests := []struct {
+		name               string
+		status             int
+		retryAfter         string
+		retries            int
+		expectedError      error
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name:   "Succeeded batch has the request ID",
+			status: http.StatusOK,
+		},
+		{
+			name:          "Failed batch has the batch error",
+			status:        http.StatusInternalServerError,
+			expectedError: &StatusError{StatusCode: http.StatusInternalServerError},
+		},
+		{
+			name:               "Throttled batch has the retry hint",
+			status:             http.StatusTooManyRequests,
+			retryAfter:         "3600",
+			expectedError:      &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour},
+			expectedRetryAfter: time.Hour,
+		},
+		{
+			name:          "Throttled batch which is retried already has no retry hint",
+			status:        http.StatusTooManyRequests,
+			retryAfter:    "1",
+			retries:       1,
+			expectedError: &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			echo := newEchoHandler(t)
+			hp := newTestingHTTPProcessor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(REQUEST_ID_HEADER, "request-1")
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					return
+				}
+				echo(w, r)
+			}))
+			assert.NoError(t, hp.SetRetries(tt.retries))
+
+			batchResult := hp.ProcessBatch(context.Background(), testingJobs("a", "b"))
+			assert.Equal(t, "request-1", batchResult.RequestID)
+			assert.Equal(t, tt.expectedError, batchResult.Error)
+			assert.Equal(t, tt.expectedRetryAfter, batchResult.RetryAfter)
+			assert.Len(t, batchResult.Results, 2)
+			for _, result := range batchResult.Results {
+				assert.Equal(t, tt.expectedError, result.Errors)
+			}
+		})
+	}
+}
@@ -1,9 +1,30 @@
 package processor
 
-import "microbatcher/pkg/types"
+import (
+	"context"
+	"microbatcher/pkg/types"
+)
 
 // BatchProcessor is a contract for processing batch of jobs and return results.
-// You will need to implement your specific business process logic.
+// You will need to implement your specific business process logic. A batcher processes its batches one at a
+// time, except with a batch timeout: it does not wait for a timed out call, so Process must be safe for concurrent
+// use then, unless it returns once the context of ContextBatchProcessor is cancelled. A processor shared by
+// several batchers, like the batchers of a pool, is called concurrently and must be safe for concurrent use.
 type BatchProcessor[I types.JobId, T any] interface {
 	Process(jobs []*types.Job[I, T]) []*types.JobResult[I, T]
 }
+
+// ContextBatchProcessor is an optional extension of BatchProcessor. The batcher prefers ProcessContext
+// when it is implemented, and the given context is cancelled once the batch timeout is exceeded.
+type ContextBatchProcessor[I types.JobId, T any] interface {
+	BatchProcessor[I, T]
+	ProcessContext(ctx context.Context, jobs []*types.Job[I, T]) []*types.JobResult[I, T]
+}
+
+// BatchResultProcessor is an optional extension of BatchProcessor which returns batch wide information besides the
+// job results, such as a batch error, a request ID or a retry hint. The batcher prefers ProcessBatch over the
+// other methods when it is implemented, and cancels the given context like for ContextBatchProcessor.
+type BatchResultProcessor[I types.JobId, T any] interface {
+	BatchProcessor[I, T]
+	ProcessBatch(ctx context.Context, jobs []*types.Job[I, T]) *types.BatchResult[I, T]
+}
@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"microbatcher/pkg/types"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_MAX_PLACEHOLDERS = 999
+
+// PlaceholderStyle is the bind parameter syntax of a database driver.
+type PlaceholderStyle int
+
+const (
+	// PlaceholderQuestion binds parameters by "?", e.g. for SQLite and MySQL.
+	PlaceholderQuestion PlaceholderStyle = iota
+	// PlaceholderDollar binds parameters by "$1", "$2" and so on, e.g. for PostgreSQL.
+	PlaceholderDollar
+)
+
+func (ps PlaceholderStyle) String() string {
+	switch ps {
+	case PlaceholderQuestion:
+		return "question"
+	case PlaceholderDollar:
+		return "dollar"
+	default:
+		return "unknown"
+	}
+}
+
+// RowMapper maps a job to the values of its row, in the order of the columns of the processor.
+type RowMapper[I types.JobId, T any] func(job *types.Job[I, T]) ([]any, error)
+
+// SQLProcessor inserts every batch into a table by multi-row INSERT statements within one transaction. A
+// statement binds at most the maximum placeholders, so larger batches are split into several statements.
+//
+// When the transaction fails, the rows are executed one by one instead, so that the errors are attributed to
+// the failing jobs and the other jobs still succeed. Results carry the data of their job.
+type SQLProcessor[I types.JobId, T any] struct {
+	name             string
+	db               *sql.DB
+	table            string
+	columns          []string
+	rowMapper        RowMapper[I, T]
+	conflictClause   string
+	placeholderStyle PlaceholderStyle
+	maxPlaceholders  int
+}
+
+// NewSQLProcessor creates a new SQL processor inserting rows of the columns into the table.
+func NewSQLProcessor[I types.JobId, T any](
+	name string,
+	db *sql.DB,
+	table string,
+	columns []string,
+	rowMapper RowMapper[I, T],
+) (*SQLProcessor[I, T], error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+
+	if table == "" {
+		return nil, errors.New("table must not be empty")
+	}
+
+	if len(columns) == 0 {
+		return nil, errors.New("columns must not be empty")
+	}
+
+	if rowMapper == nil {
+		return nil, errors.New("rowMapper must not be nil")
+	}
+
+	return &SQLProcessor[I, T]{
+		name:             name,
+		db:               db,
+		table:            table,
+		columns:          columns,
+		rowMapper:        rowMapper,
+		placeholderStyle: PlaceholderQuestion,
+		maxPlaceholders:  DEFAULT_MAX_PLACEHOLDERS,
+	}, nil
+}
+
+// SetConflictClause sets the clause appended to every statement, which turns the inserts into upserts, e.g.
+// "ON CONFLICT (id) DO UPDATE SET name = excluded.name".
+func (sp *SQLProcessor[I, T]) SetConflictClause(conflictClause string) {
+	sp.conflictClause = conflictClause
+}
+
+// SetPlaceholderStyle sets the bind parameter syntax of the database driver.
+func (sp *SQLProcessor[I, T]) SetPlaceholderStyle(placeholderStyle PlaceholderStyle) {
+	sp.placeholderStyle = placeholderStyle
+}
+
+// SetMaxPlaceholders sets the maximum bind parameters of a statement, which must fit at least one row.
+func (sp *SQLProcessor[I, T]) SetMaxPlaceholders(maxPlaceholders int) error {
+	if maxPlaceholders < len(sp.columns) {
+		return errors.New("maxPlaceholders must fit at least one row")
+	}
+
+	sp.maxPlaceholders = maxPlaceholders
+	return nil
+}
+
+func (sp *SQLProcessor[I, T]) Process(jobs []*types.Job[I, T]) []*types.JobResult[I, T] {
+	return sp.ProcessContext(context.Background(), jobs)
+}
+
+func (sp *SQLProcessor[I, T]) ProcessContext(ctx context.Context, jobs []*types.Job[I, T]) []*types.JobResult[I, T] {
+	results := make([]*types.JobResult[I, T], len(jobs))
+	var mapped []int
+	var rows [][]any
+	for i, job := range jobs {
+		results[i] = &types.JobResult[I, T]{ID: job.ID, Data: job.Data}
+		row, err := sp.rowMapper(job)
+		if err == nil && len(row) != len(sp.columns) {
+			err = fmt.Errorf("row has %d values for %d columns", len(row), len(sp.columns))
+		}
+		if err != nil {
+			results[i].Errors = fmt.Errorf("failed to map row: %w", err)
+			continue
+		}
+		mapped = append(mapped, i)
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return results
+	}
+
+	if err := sp.insertAll(ctx, rows); err != nil {
+		slog.Warn(fmt.Sprintf("%s fails to insert %d rows at once, falls back to single rows: %s", sp.name, len(rows), err))
+		for i, row := range rows {
+			_, results[mapped[i]].Errors = sp.db.ExecContext(ctx, sp.statement(1), row...)
+		}
+	}
+	return results
+}
+
+// insertAll inserts the rows within one transaction, split by the maximum placeholders of a statement.
+func (sp *SQLProcessor[I, T]) insertAll(ctx context.Context, rows [][]any) error {
+	tx, err := sp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	rowsPerStatement := sp.maxPlaceholders / len(sp.columns)
+	for start := 0; start < len(rows); start += rowsPerStatement {
+		end := min(start+rowsPerStatement, len(rows))
+		args := make([]any, 0, (end-start)*len(sp.columns))
+		for _, row := range rows[start:end] {
+			args = append(args, row...)
+		}
+
+		if _, err := tx.ExecContext(ctx, sp.statement(end-start), args...); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// statement builds the INSERT statement of the given number of rows.
+func (sp *SQLProcessor[I, T]) statement(rowCount int) string {
+	var builder strings.Builder
+	builder.WriteString("INSERT INTO ")
+	builder.WriteString(sp.table)
+	builder.WriteString(" (")
+	builder.WriteString(strings.Join(sp.columns, ", "))
+	builder.WriteString(") VALUES ")
+
+	placeholder := 0
+	for i := 0; i < rowCount; i++ {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString("(")
+		for j := range sp.columns {
+			if j > 0 {
+				builder.WriteString(", ")
+			}
+			placeholder++
+			if sp.placeholderStyle == PlaceholderDollar {
+				builder.WriteString("$" + strconv.Itoa(placeholder))
+			} else {
+				builder.WriteString("?")
+			}
+		}
+		builder.WriteString(")")
+	}
+
+	if sp.conflictClause != "" {
+		builder.WriteString(" ")
+		builder.WriteString(sp.conflictClause)
+	}
+	return builder.String()
+}
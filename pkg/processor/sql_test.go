@@ -0,0 +1,287 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"microbatcher/pkg/types"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDatabase is a database/sql driver which records the executed statements and stores the bound values as
+// rows. Statements binding the value "poison" fail, and the rows of a transaction are only stored on commit.
+type fakeDatabase struct {
+	mutex      sync.Mutex
+	statements []string
+	rows       []driver.Value
+	failCommit bool
+}
+
+func (fd *fakeDatabase) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{database: fd}, nil
+}
+
+func (fd *fakeDatabase) Driver() driver.Driver {
+	return nil
+}
+
+func (fd *fakeDatabase) getStatements() []string {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+
+	return fd.statements
+}
+
+func (fd *fakeDatabase) getRows() []driver.Value {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+
+	return fd.rows
+}
+
+type fakeConn struct {
+	database *fakeDatabase
+	pending  []driver.Value
+	inTx     bool
+}
+
+func (fc *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: fc, query: query}, nil
+}
+
+func (fc *fakeConn) Close() error {
+	return nil
+}
+
+func (fc *fakeConn) Begin() (driver.Tx, error) {
+	fc.inTx = true
+	fc.pending = nil
+	return fc, nil
+}
+
+func (fc *fakeConn) Commit() error {
+	fc.inTx = false
+	fc.database.mutex.Lock()
+	defer fc.database.mutex.Unlock()
+
+	if fc.database.failCommit {
+		return errors.New("commit failed")
+	}
+	fc.database.rows = append(fc.database.rows, fc.pending...)
+	return nil
+}
+
+func (fc *fakeConn) Rollback() error {
+	fc.inTx = false
+	fc.pending = nil
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (fs *fakeStmt) Close() error {
+	return nil
+}
+
+func (fs *fakeStmt) NumInput() int {
+	return strings.Count(fs.query, "?")
+}
+
+func (fs *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	database := fs.conn.database
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	database.statements = append(database.statements, fs.query)
+	for _, arg := range args {
+		if arg == "poison" {
+			return nil, errors.New("poison value")
+		}
+	}
+
+	if fs.conn.inTx {
+		fs.conn.pending = append(fs.conn.pending, args...)
+	} else {
+		database.rows = append(database.rows, args...)
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (fs *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("query is not supported")
+}
+
+func newTestingSQLProcessor(t *testing.T) (*SQLProcessor[int, string], *fakeDatabase) {
+	database := &fakeDatabase{}
+	db := sql.OpenDB(database)
+	t.Cleanup(func() { _ = db.Close() })
+
+	sp, err := NewSQLProcessor[int, string]("test", db, "jobs", []string{"id", "data"}, func(job *types.Job[int, string]) ([]any, error) {
+		if job.Data == "unmapped" {
+			return nil, errors.New("unmapped data")
+		}
+		return []any{int64(job.ID), job.Data}, nil
+	})
+	assert.NoError(t, err)
+	return sp, database
+}
+
+func TestNewSQLProcessor(t *testing.T) {
+	db := sql.OpenDB(&fakeDatabase{})
+	defer db.Close()
+	rowMapper := func(job *types.Job[int, string]) ([]any, error) { return []any{job.ID}, nil }
+
+	tests := []struct {
+		name          string
+		db            *sql.DB
+		table         string
+		columns       []string
+		rowMapper     RowMapper[int, string]
+		expectedError string
+	}{
+		{name: "Valid processor", db: db, table: "jobs", columns: []string{"id"}, rowMapper: rowMapper},
+		{name: "Missing db", table: "jobs", columns: []string{"id"}, rowMapper: rowMapper, expectedError: "db must not be nil"},
+		{name: "Missing table", db: db, columns: []string{"id"}, rowMapper: rowMapper, expectedError: "table must not be empty"},
+		{name: "Missing columns", db: db, table: "jobs", rowMapper: rowMapper, expectedError: "columns must not be empty"},
+		{name: "Missing row mapper", db: db, table: "jobs", columns: []string{"id"}, expectedError: "rowMapper must not be nil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSQLProcessor("test", tt.db, tt.table, tt.columns, tt.rowMapper)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestSQLProcessorStatement(t *testing.T) {
+	tests := []struct {
+		name             string
+		placeholderStyle PlaceholderStyle
+		conflictClause   string
+		rowCount         int
+		expected         string
+	}{
+		{
+			name:     "Single row",
+			rowCount: 1,
+			expected: "INSERT INTO jobs (id, data) VALUES (?, ?)",
+		},
+		{
+			name:     "Multiple rows",
+			rowCount: 3,
+			expected: "INSERT INTO jobs (id, data) VALUES (?, ?), (?, ?), (?, ?)",
+		},
+		{
+			name:             "Dollar placeholders",
+			placeholderStyle: PlaceholderDollar,
+			rowCount:         2,
+			expected:         "INSERT INTO jobs (id, data) VALUES ($1, $2), ($3, $4)",
+		},
+		{
+			name:           "Upsert",
+			conflictClause: "ON CONFLICT (id) DO UPDATE SET data = excluded.data",
+			rowCount:       1,
+			expected:       "INSERT INTO jobs (id, data) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp, _ := newTestingSQLProcessor(t)
+			sp.SetPlaceholderStyle(tt.placeholderStyle)
+			sp.SetConflictClause(tt.conflictClause)
+			assert.Equal(t, tt.expected, sp.statement(tt.rowCount))
+		})
+	}
+}
+
+func TestSQLProcessorProcess(t *testing.T) {
+	tests := []struct {
+		name               string
+		data               []string
+		maxPlaceholders    int
+		failCommit         bool
+		expectedError      []string
+		expectedStatements int
+		expectedRows       []driver.Value
+	}{
+		{
+			name:               "Batch is inserted by one statement",
+			data:               []string{"a", "b", "c"},
+			expectedStatements: 1,
+			expectedRows:       []driver.Value{int64(1), "a", int64(2), "b", int64(3), "c"},
+		},
+		{
+			name:               "Batch is split by placeholder limit",
+			data:               []string{"a", "b", "c"},
+			maxPlaceholders:    5,
+			expectedStatements: 2,
+			expectedRows:       []driver.Value{int64(1), "a", int64(2), "b", int64(3), "c"},
+		},
+		{
+			name:               "Failing row is attributed by single rows",
+			data:               []string{"a", "poison", "c"},
+			maxPlaceholders:    4,
+			expectedError:      []string{"", "poison value", ""},
+			expectedStatements: 4,
+			expectedRows:       []driver.Value{int64(1), "a", int64(3), "c"},
+		},
+		{
+			name:               "Failing commit falls back to single rows",
+			data:               []string{"a", "b"},
+			failCommit:         true,
+			expectedStatements: 3,
+			expectedRows:       []driver.Value{int64(1), "a", int64(2), "b"},
+		},
+		{
+			name:               "Unmapped job fails alone",
+			data:               []string{"a", "unmapped"},
+			expectedError:      []string{"", "failed to map row: unmapped data"},
+			expectedStatements: 1,
+			expectedRows:       []driver.Value{int64(1), "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp, database := newTestingSQLProcessor(t)
+			if tt.maxPlaceholders > 0 {
+				assert.NoError(t, sp.SetMaxPlaceholders(tt.maxPlaceholders))
+			}
+			database.failCommit = tt.failCommit
+
+			results := sp.Process(testingJobs(tt.data...))
+			assert.Len(t, results, len(tt.data))
+			for i, result := range results {
+				assert.Equal(t, i+1, result.ID)
+				assert.Equal(t, tt.data[i], result.Data)
+				if tt.expectedError == nil || tt.expectedError[i] == "" {
+					assert.NoError(t, result.Errors)
+				} else {
+					assert.EqualError(t, result.Errors, tt.expectedError[i])
+				}
+			}
+			assert.Len(t, database.getStatements(), tt.expectedStatements)
+			assert.Equal(t, tt.expectedRows, database.getRows())
+		})
+	}
+}
+
+func TestSQLProcessorSetMaxPlaceholders(t *testing.T) {
+	sp, _ := newTestingSQLProcessor(t)
+	assert.EqualError(t, sp.SetMaxPlaceholders(1), "maxPlaceholders must fit at least one row")
+	assert.NoError(t, sp.SetMaxPlaceholders(2))
+}
@@ -0,0 +1,304 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"microbatcher/pkg/types"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrMalformedOutput is set on the results of a batch whose subprocess output cannot be decoded.
+var ErrMalformedOutput = errors.New("malformed subprocess output")
+
+// ErrSubprocessExited is set on the results of a batch whose subprocess exited before returning results.
+var ErrSubprocessExited = errors.New("subprocess exited")
+
+// ErrSubprocessTimeout is set on the results of a batch whose subprocess exceeded the batch timeout.
+var ErrSubprocessTimeout = errors.New("subprocess timed out")
+
+// wireJob and wireResult are the JSON forms of jobs and results exchanged with processes outside of Go.
+type wireJob[I types.JobId, T any] struct {
+	ID   I `json:"id"`
+	Data T `json:"data"`
+}
+
+type wireResult[I types.JobId, T any] struct {
+	ID    I      `json:"id"`
+	Data  T      `json:"data"`
+	Error string `json:"error,omitempty"`
+}
+
+func toWireJobs[I types.JobId, T any](jobs []*types.Job[I, T]) []wireJob[I, T] {
+	encoded := make([]wireJob[I, T], 0, len(jobs))
+	for _, job := range jobs {
+		encoded = append(encoded, wireJob[I, T]{ID: job.ID, Data: job.Data})
+	}
+	return encoded
+}
+
+// fromWireResults maps the decoded results to the jobs of the batch. A job without result gets an error, so
+// that every job ends up with a result.
+func fromWireResults[I types.JobId, T any](jobs []*types.Job[I, T], decoded []wireResult[I, T]) []*types.JobResult[I, T] {
+	byId := make(map[I]wireResult[I, T], len(decoded))
+	for _, result := range decoded {
+		byId[result.ID] = result
+	}
+
+	results := make([]*types.JobResult[I, T], 0, len(jobs))
+	for _, job := range jobs {
+		result := &types.JobResult[I, T]{ID: job.ID}
+		if decodedResult, ok := byId[job.ID]; !ok {
+			result.Errors = fmt.Errorf("no result for job %v", job.ID)
+		} else {
+			result.Data = decodedResult.Data
+			if decodedResult.Error != "" {
+				result.Errors = errors.New(decodedResult.Error)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func failJobs[I types.JobId, T any](jobs []*types.Job[I, T], err error) []*types.JobResult[I, T] {
+	results := make([]*types.JobResult[I, T], 0, len(jobs))
+	for _, job := range jobs {
+		results = append(results, &types.JobResult[I, T]{ID: job.ID, Errors: err})
+	}
+	return results
+}
+
+// SubprocessProcessor processes batches by a subprocess, which allows to keep batch logic in scripts of other
+// languages. A batch is written to stdin of the subprocess as JSON array of {"id": ..., "data": ...} and the
+// results are read from its stdout as JSON array of {"id": ..., "data": ..., "error": ...}.
+//
+// Without keep alive, the subprocess is spawned per batch and the arrays span its whole stdin and stdout. With
+// keep alive, one subprocess serves all batches with one array per line in each direction, and it is restarted
+// by the next batch after it crashed or timed out. Lines written to stderr are logged in both cases.
+type SubprocessProcessor[I types.JobId, T any] struct {
+	name      string
+	command   []string
+	keepAlive bool
+	timeout   time.Duration
+	mutex     sync.Mutex
+	process   *subprocess
+}
+
+type subprocess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	pipe   *os.File
+	stdout *bufio.Reader
+	done   chan struct{}
+}
+
+// NewSubprocessProcessor creates a new subprocess processor running the command. A zero timeout does not bound
+// the batches apart from the context given by the batcher.
+func NewSubprocessProcessor[I types.JobId, T any](
+	name string,
+	command []string,
+	keepAlive bool,
+	timeout time.Duration,
+) (*SubprocessProcessor[I, T], error) {
+	if len(command) == 0 {
+		return nil, errors.New("command must not be empty")
+	}
+
+	if timeout < 0 {
+		return nil, errors.New("timeout must not be negative")
+	}
+
+	return &SubprocessProcessor[I, T]{
+		name:      name,
+		command:   command,
+		keepAlive: keepAlive,
+		timeout:   timeout,
+	}, nil
+}
+
+func (sp *SubprocessProcessor[I, T]) Process(jobs []*types.Job[I, T]) []*types.JobResult[I, T] {
+	return sp.ProcessContext(context.Background(), jobs)
+}
+
+func (sp *SubprocessProcessor[I, T]) ProcessContext(ctx context.Context, jobs []*types.Job[I, T]) []*types.JobResult[I, T] {
+	if sp.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sp.timeout)
+		defer cancel()
+	}
+
+	input, err := json.Marshal(toWireJobs(jobs))
+	if err != nil {
+		return failJobs(jobs, err)
+	}
+
+	var output []byte
+	if sp.keepAlive {
+		output, err = sp.roundTrip(ctx, input)
+	} else {
+		output, err = sp.runOnce(ctx, input)
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("%s fails to process batch: %s", sp.name, err))
+		return failJobs(jobs, err)
+	}
+
+	var decoded []wireResult[I, T]
+	if err := json.Unmarshal(output, &decoded); err != nil {
+		slog.Error(fmt.Sprintf("%s receives malformed output: %s", sp.name, err))
+		return failJobs(jobs, fmt.Errorf("%w: %s", ErrMalformedOutput, err))
+	}
+	return fromWireResults(jobs, decoded)
+}
+
+// Close stops the kept alive subprocess. A following batch starts it again.
+func (sp *SubprocessProcessor[I, T]) Close() error {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	if sp.process == nil {
+		return nil
+	}
+	_ = sp.process.stdin.Close()
+	<-sp.process.done
+	_ = sp.process.pipe.Close()
+	sp.process = nil
+	return nil
+}
+
+// runOnce spawns the subprocess for one batch.
+func (sp *SubprocessProcessor[I, T]) runOnce(ctx context.Context, input []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, sp.command[0], sp.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderrLogger{name: sp.name}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %s", ErrSubprocessTimeout, ctx.Err())
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSubprocessExited, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// roundTrip writes one batch line to the kept alive subprocess and reads one result line back. The subprocess
+// is killed when it times out, or when it does not answer, so that the next batch starts a fresh one.
+func (sp *SubprocessProcessor[I, T]) roundTrip(ctx context.Context, input []byte) ([]byte, error) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	if sp.process == nil {
+		process, err := sp.start()
+		if err != nil {
+			return nil, err
+		}
+		sp.process = process
+	}
+	process := sp.process
+
+	type line struct {
+		content []byte
+		err     error
+	}
+	read := make(chan line, 1)
+	go func() {
+		if _, err := process.stdin.Write(append(input, '\n')); err != nil {
+			read <- line{err: err}
+			return
+		}
+		content, err := process.stdout.ReadBytes('\n')
+		read <- line{content: content, err: err}
+	}()
+
+	select {
+	case result := <-read:
+		if result.err != nil {
+			sp.kill()
+			return nil, fmt.Errorf("%w: %s", ErrSubprocessExited, result.err)
+		}
+		return result.content, nil
+	case <-ctx.Done():
+		sp.kill()
+		return nil, fmt.Errorf("%w: %s", ErrSubprocessTimeout, ctx.Err())
+	}
+}
+
+// start must be called with the mutex held. Stdout is read through a pipe of our own rather than StdoutPipe,
+// since Wait closes the pipes of StdoutPipe, and Wait is called while roundTrip may still read.
+func (sp *SubprocessProcessor[I, T]) start() (*subprocess, error) {
+	cmd := exec.Command(sp.command[0], sp.command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = &stderrLogger{name: sp.name}
+
+	err = cmd.Start()
+	// the subprocess has its own copy of the write end, so that stdout reaches EOF once it exits
+	_ = stdoutWriter.Close()
+	if err != nil {
+		_ = stdout.Close()
+		return nil, err
+	}
+	slog.Info(fmt.Sprintf("%s starts subprocess %d", sp.name, cmd.Process.Pid))
+
+	process := &subprocess{
+		cmd:    cmd,
+		stdin:  stdin,
+		pipe:   stdout,
+		stdout: bufio.NewReader(stdout),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		err := cmd.Wait()
+		slog.Info(fmt.Sprintf("%s subprocess %d exits: %v", sp.name, cmd.Process.Pid, err))
+		close(process.done)
+	}()
+	return process, nil
+}
+
+// kill must be called with the mutex held.
+func (sp *SubprocessProcessor[I, T]) kill() {
+	_ = sp.process.cmd.Process.Kill()
+	<-sp.process.done
+	_ = sp.process.pipe.Close()
+	sp.process = nil
+}
+
+// stderrLogger logs every complete line written to stderr of a subprocess.
+type stderrLogger struct {
+	name    string
+	pending []byte
+}
+
+func (sl *stderrLogger) Write(p []byte) (int, error) {
+	sl.pending = append(sl.pending, p...)
+	for {
+		end := bytes.IndexByte(sl.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		slog.Warn(fmt.Sprintf("%s stderr: %s", sl.name, sl.pending[:end]))
+		sl.pending = sl.pending[end+1:]
+	}
+}
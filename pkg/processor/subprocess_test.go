@@ -0,0 +1,256 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"microbatcher/pkg/types"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const SUBPROCESS_HELPER_ENV = "GO_WANT_SUBPROCESS_HELPER"
+
+// TestSubprocessHelper is not a real test. It is the subprocess run by the tests below, which behaves by the mode
+// given in SUBPROCESS_HELPER_ENV.
+func TestSubprocessHelper(t *testing.T) {
+	mode := os.Getenv(SUBPROCESS_HELPER_ENV)
+	if mode == "" {
+		t.Skip("helper process only")
+	}
+	defer os.Exit(0)
+
+	keepAlive := os.Getenv("HELPER_KEEP_ALIVE") != ""
+	reader := bufio.NewReader(os.Stdin)
+	for batch := 1; ; batch++ {
+		var input []byte
+		var err error
+		if keepAlive {
+			input, err = reader.ReadBytes('\n')
+		} else {
+			input, err = io.ReadAll(reader)
+		}
+		if err != nil && len(input) == 0 {
+			return
+		}
+
+		var jobs []wireJob[int, string]
+		_ = json.Unmarshal(input, &jobs)
+		results := make([]wireResult[int, string], 0, len(jobs))
+		for _, job := range jobs {
+			result := wireResult[int, string]{ID: job.ID, Data: job.Data + "-" + strconv.Itoa(batch)}
+			if job.Data == "fail" {
+				result.Error = "failed " + job.Data
+			}
+			results = append(results, result)
+		}
+
+		switch mode {
+		case "crash":
+			os.Exit(3)
+		case "crash-once":
+			if os.Getenv("HELPER_CRASHED") == "" {
+				os.Exit(3)
+			}
+		case "malformed":
+			fmt.Println("not json")
+			continue
+		case "slow":
+			time.Sleep(time.Minute)
+		case "partial":
+			results = results[:len(results)-1]
+		}
+		fmt.Fprintln(os.Stderr, "processed batch", batch)
+		output, _ := json.Marshal(results)
+		fmt.Println(string(output))
+		if !keepAlive {
+			return
+		}
+	}
+}
+
+func newTestingSubprocessProcessor(
+	t *testing.T,
+	mode string,
+	keepAlive bool,
+	timeout time.Duration,
+) *SubprocessProcessor[int, string] {
+	t.Setenv(SUBPROCESS_HELPER_ENV, mode)
+	if keepAlive {
+		t.Setenv("HELPER_KEEP_ALIVE", "1")
+	}
+	sp, err := NewSubprocessProcessor[int, string](
+		"test", []string{os.Args[0], "-test.run=^TestSubprocessHelper$"}, keepAlive, timeout,
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = sp.Close() })
+	return sp
+}
+
+func testingJobs(data ...string) []*types.Job[int, string] {
+	jobs := make([]*types.Job[int, string], 0, len(data))
+	for i, d := range data {
+		jobs = append(jobs, &types.Job[int, string]{ID: i + 1, Data: d})
+	}
+	return jobs
+}
+
+func TestNewSubprocessProcessor(t *testing.T) {
+	tests := []struct {
+		name          string
+		command       []string
+		timeout       time.Duration
+		expectedError string
+	}{
+		{name: "Valid command", command: []string{"cat"}},
+		{name: "Empty command", command: nil, expectedError: "command must not be empty"},
+		{name: "Negative timeout", command: []string{"cat"}, timeout: -time.Second, expectedError: "timeout must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSubprocessProcessor[int, string]("test", tt.command, false, tt.timeout)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestSubprocessProcessorProcess(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		keepAlive     bool
+		timeout       time.Duration
+		data          []string
+		expectedData  []string
+		expectedError []error
+	}{
+		{
+			name:         "Spawned per batch",
+			mode:         "echo",
+			data:         []string{"a", "b"},
+			expectedData: []string{"a-1", "b-1"},
+		},
+		{
+			name:         "Kept alive",
+			mode:         "echo",
+			keepAlive:    true,
+			data:         []string{"a", "b"},
+			expectedData: []string{"a-1", "b-1"},
+		},
+		{
+			name:          "Job error is returned per job",
+			mode:          "echo",
+			keepAlive:     true,
+			data:          []string{"a", "fail"},
+			expectedData:  []string{"a-1", "fail-1"},
+			expectedError: []error{nil, fmt.Errorf("failed fail")},
+		},
+		{
+			name:          "Missing result fails its job",
+			mode:          "partial",
+			data:          []string{"a", "b"},
+			expectedData:  []string{"a-1", ""},
+			expectedError: []error{nil, fmt.Errorf("no result for job 2")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestingSubprocessProcessor(t, tt.mode, tt.keepAlive, tt.timeout)
+			results := sp.Process(testingJobs(tt.data...))
+
+			assert.Len(t, results, len(tt.data))
+			for i, result := range results {
+				assert.Equal(t, i+1, result.ID)
+				assert.Equal(t, tt.expectedData[i], result.Data)
+				if tt.expectedError == nil || tt.expectedError[i] == nil {
+					assert.NoError(t, result.Errors)
+				} else {
+					assert.EqualError(t, result.Errors, tt.expectedError[i].Error())
+				}
+			}
+		})
+	}
+}
+
+func TestSubprocessProcessorFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		keepAlive     bool
+		timeout       time.Duration
+		expectedError error
+	}{
+		{name: "Crash spawned per batch", mode: "crash", expectedError: ErrSubprocessExited},
+		{name: "Crash kept alive", mode: "crash", keepAlive: true, expectedError: ErrSubprocessExited},
+		{name: "Malformed output", mode: "malformed", keepAlive: true, expectedError: ErrMalformedOutput},
+		{name: "Timeout spawned per batch", mode: "slow", timeout: 100 * time.Millisecond, expectedError: ErrSubprocessTimeout},
+		{
+			name:          "Timeout kept alive",
+			mode:          "slow",
+			keepAlive:     true,
+			timeout:       100 * time.Millisecond,
+			expectedError: ErrSubprocessTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestingSubprocessProcessor(t, tt.mode, tt.keepAlive, tt.timeout)
+			results := sp.Process(testingJobs("a", "b"))
+
+			assert.Len(t, results, 2)
+			for _, result := range results {
+				assert.ErrorIs(t, result.Errors, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestSubprocessProcessorKeepAlive(t *testing.T) {
+	sp := newTestingSubprocessProcessor(t, "echo", true, 0)
+
+	// the batch number keeps counting as long as the same subprocess serves the batches
+	for batch := 1; batch <= 3; batch++ {
+		results := sp.Process(testingJobs("a"))
+		assert.Equal(t, "a-"+strconv.Itoa(batch), results[0].Data)
+	}
+
+	// a closed subprocess is started again by the next batch
+	assert.NoError(t, sp.Close())
+	results := sp.Process(testingJobs("a"))
+	assert.Equal(t, "a-1", results[0].Data)
+}
+
+func TestSubprocessProcessorRestart(t *testing.T) {
+	sp := newTestingSubprocessProcessor(t, "crash-once", true, 0)
+
+	results := sp.Process(testingJobs("a"))
+	assert.ErrorIs(t, results[0].Errors, ErrSubprocessExited)
+
+	// the crashed subprocess is replaced by a new one for the next batch
+	t.Setenv("HELPER_CRASHED", "1")
+	results = sp.Process(testingJobs("a"))
+	assert.NoError(t, results[0].Errors)
+	assert.Equal(t, "a-1", results[0].Data)
+}
+
+func TestSubprocessProcessorContext(t *testing.T) {
+	sp := newTestingSubprocessProcessor(t, "slow", true, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	results := sp.ProcessContext(ctx, testingJobs("a"))
+	assert.ErrorIs(t, results[0].Errors, ErrSubprocessTimeout)
+}
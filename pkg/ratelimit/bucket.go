@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"microbatcher/pkg/clock"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a token bucket rate limiter whose limit can be adjusted at runtime.
+type TokenBucket struct {
+	mutex  sync.Mutex
+	limit  Limit
+	tokens float64
+	last   time.Time
+	clock  clock.Clock
+}
+
+// NewTokenBucket creates a new full token bucket with the given limit which measures time by the clock.
+func NewTokenBucket(limit Limit, clk clock.Clock) *TokenBucket {
+	return &TokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   clk.Now(),
+		clock:  clk,
+	}
+}
+
+// Allow takes n tokens if they are available right now.
+func (tb *TokenBucket) Allow(n int) bool {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	if tb.limit.Unlimited() {
+		return true
+	}
+
+	tb.refill()
+	if tb.tokens < float64(n) {
+		return false
+	}
+	tb.tokens -= float64(n)
+	return true
+}
+
+// Wait takes n tokens and blocks until they are paid off. Requests larger than the burst are allowed and
+// put the bucket into debt, which later requests have to wait for.
+func (tb *TokenBucket) Wait(ctx context.Context, n int) error {
+	tb.mutex.Lock()
+	if tb.limit.Unlimited() {
+		tb.mutex.Unlock()
+		return nil
+	}
+
+	tb.refill()
+	tb.tokens -= float64(n)
+	delay := time.Duration(-tb.tokens / tb.limit.Rate * float64(time.Second))
+	tb.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := tb.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		// give the reserved tokens back since they are never used
+		tb.mutex.Lock()
+		tb.tokens += float64(n)
+		tb.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Return gives back n tokens which were taken but are not used, e.g. for jobs which are rejected after all. The
+// tokens are capped to the burst.
+func (tb *TokenBucket) Return(n int) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	if tb.limit.Unlimited() {
+		return
+	}
+
+	tb.refill()
+	tb.tokens = min(tb.tokens+float64(n), float64(tb.limit.Burst))
+}
+
+// SetLimit adjusts the limit. The current tokens are capped to the new burst.
+func (tb *TokenBucket) SetLimit(limit Limit) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	tb.refill()
+	if tb.limit.Unlimited() || tb.tokens > float64(limit.Burst) {
+		tb.tokens = float64(limit.Burst)
+	}
+	tb.limit = limit
+}
+
+// GetLimit returns the current limit.
+func (tb *TokenBucket) GetLimit() Limit {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	return tb.limit
+}
+
+// refill must be called with the mutex held.
+func (tb *TokenBucket) refill() {
+	now := tb.clock.Now()
+	elapsed := now.Sub(tb.last).Seconds()
+	tb.last = now
+
+	tb.tokens += elapsed * tb.limit.Rate
+	if tb.tokens > float64(tb.limit.Burst) {
+		tb.tokens = float64(tb.limit.Burst)
+	}
+}
@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"context"
+	"microbatcher/pkg/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestingTokenBucket(limit Limit) (*TokenBucket, *clock.Fake) {
+	fakeClock := clock.NewFake(time.Now())
+	return NewTokenBucket(limit, fakeClock), fakeClock
+}
+
+func TestTokenBucketAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    Limit
+		elapsed  time.Duration
+		takes    []int
+		expected []bool
+	}{
+		{
+			name:     "Unlimited bucket always allows",
+			limit:    Limit{},
+			takes:    []int{100, 100},
+			expected: []bool{true, true},
+		},
+		{
+			name:     "Burst is taken at once and then exhausted",
+			limit:    Limit{Rate: 1, Burst: 3},
+			takes:    []int{2, 1, 1},
+			expected: []bool{true, true, false},
+		},
+		{
+			name:     "Bucket is refilled by rate but capped to burst",
+			limit:    Limit{Rate: 10, Burst: 2},
+			elapsed:  time.Second,
+			takes:    []int{2, 1},
+			expected: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb, fakeClock := newTestingTokenBucket(tt.limit)
+			fakeClock.Advance(tt.elapsed)
+			for i, n := range tt.takes {
+				assert.Equal(t, tt.expected[i], tb.Allow(n))
+			}
+		})
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	tb, fakeClock := newTestingTokenBucket(Limit{Rate: 20, Burst: 1})
+
+	// the first token is in the bucket, the next one takes 50ms
+	assert.Nil(t, tb.Wait(context.Background(), 1))
+
+	done := make(chan error)
+	go func() {
+		done <- tb.Wait(context.Background(), 1)
+	}()
+
+	fakeClock.BlockUntilTimers(1)
+	fakeClock.Advance(49 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("wait returns before the token is refilled")
+	default:
+	}
+
+	fakeClock.Advance(1 * time.Millisecond)
+	assert.Nil(t, <-done)
+}
+
+func TestTokenBucketWaitCancelled(t *testing.T) {
+	tb, fakeClock := newTestingTokenBucket(Limit{Rate: 1, Burst: 1})
+	assert.Nil(t, tb.Wait(context.Background(), 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- tb.Wait(ctx, 1)
+	}()
+
+	fakeClock.BlockUntilTimers(1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// the reserved token is given back, so a second later the bucket is full again
+	fakeClock.Advance(1 * time.Second)
+	assert.True(t, tb.Allow(1))
+}
+
+func TestTokenBucketReturn(t *testing.T) {
+	tb, _ := newTestingTokenBucket(Limit{Rate: 1, Burst: 3})
+	assert.True(t, tb.Allow(3))
+	assert.False(t, tb.Allow(1))
+
+	tb.Return(2)
+	assert.True(t, tb.Allow(2))
+	assert.False(t, tb.Allow(1))
+
+	// returned tokens do not exceed the burst
+	tb.Return(5)
+	assert.False(t, tb.Allow(4))
+	assert.True(t, tb.Allow(3))
+}
+
+func TestTokenBucketSetLimit(t *testing.T) {
+	tb, _ := newTestingTokenBucket(Limit{Rate: 1, Burst: 5})
+	tb.SetLimit(Limit{Rate: 1, Burst: 2})
+
+	assert.Equal(t, Limit{Rate: 1, Burst: 2}, tb.GetLimit())
+	assert.True(t, tb.Allow(2))
+	assert.False(t, tb.Allow(1))
+
+	tb.SetLimit(Limit{})
+	assert.True(t, tb.Allow(100))
+}
+
+func TestNewCustomConfig(t *testing.T) {
+	tests := []struct {
+		name                string
+		limit               Limit
+		expectError         bool
+		expectedErrorString string
+	}{
+		{
+			name:        "Valid rate limit config",
+			limit:       Limit{Rate: 10, Burst: 5},
+			expectError: false,
+		},
+		{
+			name:        "Valid unlimited rate limit config",
+			limit:       Limit{},
+			expectError: false,
+		},
+		{
+			name:                "Invalid negative rate",
+			limit:               Limit{Rate: -1, Burst: 5},
+			expectError:         true,
+			expectedErrorString: "rate and burst must not be negative",
+		},
+		{
+			name:                "Invalid zero burst with rate",
+			limit:               Limit{Rate: 10},
+			expectError:         true,
+			expectedErrorString: "burst must be positive when rate is set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewCustomConfig(Limit{}, Limit{}, tt.limit, PolicyReject)
+
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrorString)
+				assert.Equal(t, Config{}, config)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.limit, config.GetSubmit())
+				assert.Equal(t, PolicyReject, config.GetPolicy())
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"errors"
+)
+
+// Policy decides what Submit does when the admission rate limit is exceeded.
+type Policy int
+
+const (
+	// PolicyWait blocks the submission until a token is available.
+	PolicyWait Policy = iota
+	// PolicyReject rejects the submission with ErrRateLimited.
+	PolicyReject
+)
+
+func (p Policy) String() string {
+	switch p {
+	case PolicyWait:
+		return "wait"
+	case PolicyReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// Limit is a token bucket limit. A zero rate means unlimited.
+type Limit struct {
+	// Rate is the number of tokens refilled per second.
+	Rate float64
+	// Burst is the bucket capacity, which is the number of tokens that can be taken at once.
+	Burst int
+}
+
+// Unlimited reports whether the limit does not throttle at all.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+func (l Limit) validate() error {
+	if l.Rate < 0 || l.Burst < 0 {
+		return errors.New("rate and burst must not be negative")
+	}
+
+	if l.Rate > 0 && l.Burst < 1 {
+		return errors.New("burst must be positive when rate is set")
+	}
+	return nil
+}
+
+type Config struct {
+	dispatchBatches Limit
+	dispatchItems   Limit
+	submit          Limit
+	policy          Policy
+}
+
+// NewCustomConfig creates and returns a new rate limit config. dispatchBatches and dispatchItems throttle the calls
+// to the batch processor in batches and jobs per second, while submit throttles the admission of Submit.
+func NewCustomConfig(dispatchBatches Limit, dispatchItems Limit, submit Limit, policy Policy) (Config, error) {
+	for _, limit := range []Limit{dispatchBatches, dispatchItems, submit} {
+		if err := limit.validate(); err != nil {
+			return Config{}, err
+		}
+	}
+
+	return Config{
+		dispatchBatches: dispatchBatches,
+		dispatchItems:   dispatchItems,
+		submit:          submit,
+		policy:          policy,
+	}, nil
+}
+
+// GetDispatchBatches returns the limit of batches dispatched to the processor.
+func (c *Config) GetDispatchBatches() Limit {
+	return c.dispatchBatches
+}
+
+// GetDispatchItems returns the limit of jobs dispatched to the processor.
+func (c *Config) GetDispatchItems() Limit {
+	return c.dispatchItems
+}
+
+// GetSubmit returns the limit of submitted jobs.
+func (c *Config) GetSubmit() Limit {
+	return c.submit
+}
+
+// GetPolicy returns the policy applied to submissions over the limit.
+func (c *Config) GetPolicy() Policy {
+	return c.policy
+}
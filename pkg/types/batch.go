@@ -0,0 +1,40 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// BatchResult is the outcome of a batch process. Besides the results of the jobs of the batch, it carries batch
+// wide information, such as an error failing the whole batch and metadata of the downstream request.
+type BatchResult[I JobId, T any] struct {
+	Results []*JobResult[I, T]
+	// Error fails the whole batch, e.g. when the downstream rejected the request of the batch.
+	Error error
+	// RequestID identifies the downstream request of the batch, e.g. to correlate logs.
+	RequestID string
+	// PartialFailure reports that some jobs of the batch failed while others succeeded.
+	PartialFailure bool
+	// RetryAfter is the hint of the downstream when to retry a failed batch. Zero means no hint.
+	RetryAfter time.Duration
+	Metadata   map[string]string
+}
+
+// Failed reports whether the whole batch failed, which is when it has a batch error or every result carries an
+// error.
+func (br *BatchResult[I, T]) Failed() bool {
+	if br.Error != nil {
+		return true
+	}
+
+	for _, result := range br.Results {
+		if result.Errors == nil {
+			return false
+		}
+	}
+	return len(br.Results) > 0
+}
+
+func (br *BatchResult[I, T]) String() string {
+	return fmt.Sprintf("batch result: results=%d, request id=%s", len(br.Results), br.RequestID)
+}
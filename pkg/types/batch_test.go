@@ -0,0 +1,39 @@
+package types
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchResultFailed(t *testing.T) {
+	failed := &JobResult[int, string]{ID: 1, Errors: errors.New("failed")}
+	succeeded := &JobResult[int, string]{ID: 2}
+
+	tests := []struct {
+		name     string
+		result   *BatchResult[int, string]
+		expected bool
+	}{
+		{name: "Empty batch", result: &BatchResult[int, string]{}, expected: false},
+		{name: "Succeeded batch", result: &BatchResult[int, string]{Results: []*JobResult[int, string]{succeeded}}, expected: false},
+		{
+			name:     "Partially failed batch",
+			result:   &BatchResult[int, string]{Results: []*JobResult[int, string]{failed, succeeded}},
+			expected: false,
+		},
+		{name: "Batch with failed jobs only", result: &BatchResult[int, string]{Results: []*JobResult[int, string]{failed}}, expected: true},
+		{
+			name:     "Batch with batch error",
+			result:   &BatchResult[int, string]{Results: []*JobResult[int, string]{succeeded}, Error: errors.New("rejected")},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.result.Failed())
+		})
+	}
+}
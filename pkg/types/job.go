@@ -1,6 +1,9 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type JobId interface {
 	~int | ~string
@@ -9,16 +12,103 @@ type JobId interface {
 type Job[I JobId, T any] struct {
 	ID   I
 	Data T
+	// IdempotencyKey identifies resubmissions of the job when the batcher has an idempotency store. Jobs without
+	// key are identified by their ID.
+	IdempotencyKey string
+	// Deadline is the time after which the job is no longer worth processing. The zero time means no deadline.
+	Deadline time.Time
 }
 
 func (j *Job[I, T]) String() string {
 	return fmt.Sprintf("job: id=%v", j.ID)
 }
 
+// Expired reports whether the deadline of the job has passed at the given time.
+func (j *Job[I, T]) Expired(now time.Time) bool {
+	return !j.Deadline.IsZero() && now.After(j.Deadline)
+}
+
+// JobStatus is the lifecycle state of a job.
+type JobStatus int
+
+const (
+	// JobStatusUnknown is the status of results which are not stamped by a batcher.
+	JobStatusUnknown JobStatus = iota
+	// JobStatusAccepted is the status of a job which is accepted but not queued yet, e.g. a delayed job.
+	JobStatusAccepted
+	// JobStatusQueued is the status of a job which waits in the job queue or in the pending batch.
+	JobStatusQueued
+	// JobStatusProcessing is the status of a job whose batch is being processed.
+	JobStatusProcessing
+	// JobStatusSucceeded is the status of a job whose result has no error.
+	JobStatusSucceeded
+	// JobStatusFailed is the status of a job whose result has an error.
+	JobStatusFailed
+	// JobStatusExpired is the status of a job whose deadline passed before it was processed.
+	JobStatusExpired
+	// JobStatusDropped is the status of a job which the processor returned no result for.
+	JobStatusDropped
+)
+
+func (js JobStatus) String() string {
+	switch js {
+	case JobStatusAccepted:
+		return "accepted"
+	case JobStatusQueued:
+		return "queued"
+	case JobStatusProcessing:
+		return "processing"
+	case JobStatusSucceeded:
+		return "succeeded"
+	case JobStatusFailed:
+		return "failed"
+	case JobStatusExpired:
+		return "expired"
+	case JobStatusDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the status by its name, e.g. for JSON APIs.
+func (js JobStatus) MarshalText() ([]byte, error) {
+	return []byte(js.String()), nil
+}
+
+// UnmarshalText decodes the status by its name.
+func (js *JobStatus) UnmarshalText(text []byte) error {
+	for status := JobStatusUnknown; status <= JobStatusDropped; status++ {
+		if status.String() == string(text) {
+			*js = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown job status %q", text)
+}
+
+// Done reports whether the status is final.
+func (js JobStatus) Done() bool {
+	return js >= JobStatusSucceeded
+}
+
+// JobResult is the result of a job. Processors set the ID, data and errors, and the batcher stamps the other
+// fields, so that results describe themselves in logs and APIs.
 type JobResult[I JobId, T any] struct {
 	ID     I
 	Data   T
 	Errors error
+	Status JobStatus
+	// SubmittedAt, StartedAt and FinishedAt are the times of the submission of the job, of the start of its batch
+	// process and of its result. They are zero while not reached.
+	SubmittedAt time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	// BatchSequence numbers the batches dispatched by a batcher, starting with 1.
+	BatchSequence int
+	// Attempts counts how often the job was passed to the processor, including batch retries and bisects.
+	Attempts int
+	Batcher  string
 }
 
 func (jr *JobResult[I, T]) String() string {
@@ -2,6 +2,7 @@ package types
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -99,3 +100,61 @@ func TestJobResultStringWithStringId(t *testing.T) {
 		})
 	}
 }
+
+func TestJobExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		deadline time.Time
+		expected bool
+	}{
+		{name: "Job without deadline", expected: false},
+		{name: "Job before deadline", deadline: now.Add(time.Second), expected: false},
+		{name: "Job at deadline", deadline: now, expected: false},
+		{name: "Job after deadline", deadline: now.Add(-time.Second), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &Job[int, string]{ID: 1, Deadline: tt.deadline}
+			assert.Equal(t, tt.expected, job.Expired(now))
+		})
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	tests := []struct {
+		status       JobStatus
+		expectedName string
+		expectedDone bool
+	}{
+		{status: JobStatusUnknown, expectedName: "unknown"},
+		{status: JobStatusAccepted, expectedName: "accepted"},
+		{status: JobStatusQueued, expectedName: "queued"},
+		{status: JobStatusProcessing, expectedName: "processing"},
+		{status: JobStatusSucceeded, expectedName: "succeeded", expectedDone: true},
+		{status: JobStatusFailed, expectedName: "failed", expectedDone: true},
+		{status: JobStatusExpired, expectedName: "expired", expectedDone: true},
+		{status: JobStatusDropped, expectedName: "dropped", expectedDone: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expectedName, func(t *testing.T) {
+			assert.Equal(t, tt.expectedName, tt.status.String())
+			assert.Equal(t, tt.expectedDone, tt.status.Done())
+
+			text, err := tt.status.MarshalText()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedName, string(text))
+
+			var decoded JobStatus
+			assert.NoError(t, decoded.UnmarshalText(text))
+			assert.Equal(t, tt.status, decoded)
+		})
+	}
+}
+
+func TestJobStatusUnmarshalUnknown(t *testing.T) {
+	var status JobStatus
+	assert.EqualError(t, status.UnmarshalText([]byte("lost")), `unknown job status "lost"`)
+}
@@ -0,0 +1,158 @@
+package microbatcher
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"microbatcher/pkg/configs"
+	"microbatcher/pkg/processor"
+	"microbatcher/pkg/types"
+	"sort"
+	"sync/atomic"
+)
+
+const VIRTUAL_NODES_PER_BATCHER = 100
+
+// RoutingStrategy decides which batcher of a pool a job is submitted to.
+type RoutingStrategy int
+
+const (
+	// RoutingRoundRobin submits jobs to the batchers in turn.
+	RoutingRoundRobin RoutingStrategy = iota
+	// RoutingLeastQueueDepth submits jobs to the batcher with the fewest queued jobs.
+	RoutingLeastQueueDepth
+	// RoutingConsistentHash submits jobs with the same ID to the same batcher.
+	RoutingConsistentHash
+)
+
+type ringNode struct {
+	hash    uint32
+	batcher int
+}
+
+// Pool owns several batchers sharing one processor and distributes the submitted jobs across them.
+// When the routed batcher rejects a job, the job fails over to the next batcher of the pool.
+type Pool[I types.JobId, T any] struct {
+	name     string
+	batchers []*microBatcher[I, T]
+	strategy RoutingStrategy
+	next     atomic.Uint64
+	ring     []ringNode
+}
+
+// NewPool creates a new pool of size batchers named after the pool, which share the processor and configurations.
+// The batchers process their batches independently, so the processor is called concurrently and must be safe for
+// concurrent use.
+func NewPool[I types.JobId, T any](
+	name string,
+	size int,
+	processor processor.BatchProcessor[I, T],
+	config configs.BatcherConfig,
+	strategy RoutingStrategy,
+) (*Pool[I, T], error) {
+	if size < 1 {
+		return nil, errors.New("pool size must be positive")
+	}
+
+	pool := &Pool[I, T]{
+		name:     name,
+		strategy: strategy,
+	}
+	for i := 0; i < size; i++ {
+		batcherName := fmt.Sprintf("%s-%02d", name, i+1)
+		pool.batchers = append(pool.batchers, NewMicroBatcher(batcherName, processor, config))
+
+		for v := 0; v < VIRTUAL_NODES_PER_BATCHER; v++ {
+			pool.ring = append(pool.ring, ringNode{
+				hash:    hashKey(fmt.Sprintf("%s#%d", batcherName, v)),
+				batcher: i,
+			})
+		}
+	}
+	sort.Slice(pool.ring, func(a, b int) bool {
+		return pool.ring[a].hash < pool.ring[b].hash
+	})
+
+	return pool, nil
+}
+
+// Submit routes the job to one of the batchers and fails over to the others when it is rejected.
+// The error of the last attempted batcher is returned when every batcher rejects the job.
+func (p *Pool[I, T]) Submit(job *types.Job[I, T]) (*types.JobResult[I, T], error) {
+	first := p.route(job)
+
+	var lastErr error
+	for i := 0; i < len(p.batchers); i++ {
+		batcher := p.batchers[(first+i)%len(p.batchers)]
+		result, err := batcher.Submit(job)
+		if err == nil {
+			return result, nil
+		}
+		slog.Warn(fmt.Sprintf("%s fails over %s since %s rejects it: %s", p.name, job, batcher.name, err))
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// Start starts all batchers of the pool. Batchers which are started already are shut down again on failure.
+func (p *Pool[I, T]) Start() error {
+	for i, batcher := range p.batchers {
+		if err := batcher.Start(); err != nil {
+			for _, started := range p.batchers[:i] {
+				_ = started.Shutdown()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown shuts down all batchers of the pool and returns after all accepted jobs are processed.
+func (p *Pool[I, T]) Shutdown() error {
+	var errs []error
+	for _, batcher := range p.batchers {
+		if err := batcher.Shutdown(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", batcher.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetCurrentResults returns the current results of all batchers of the pool.
+func (p *Pool[I, T]) GetCurrentResults() []*types.JobResult[I, T] {
+	var results []*types.JobResult[I, T]
+	for _, batcher := range p.batchers {
+		results = append(results, batcher.GetCurrentResults()...)
+	}
+	return results
+}
+
+// route returns the index of the batcher the job is submitted to first.
+func (p *Pool[I, T]) route(job *types.Job[I, T]) int {
+	switch p.strategy {
+	case RoutingLeastQueueDepth:
+		least := 0
+		leastDepth := p.batchers[0].queueDepth()
+		for i := 1; i < len(p.batchers); i++ {
+			if depth := p.batchers[i].queueDepth(); depth < leastDepth {
+				least, leastDepth = i, depth
+			}
+		}
+		return least
+	case RoutingConsistentHash:
+		hash := hashKey(fmt.Sprint(job.ID))
+		i := sort.Search(len(p.ring), func(i int) bool {
+			return p.ring[i].hash >= hash
+		})
+		return p.ring[i%len(p.ring)].batcher
+	default:
+		return int((p.next.Add(1) - 1) % uint64(len(p.batchers)))
+	}
+}
+
+func hashKey(key string) uint32 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return hash.Sum32()
+}
@@ -0,0 +1,103 @@
+package microbatcher
+
+import (
+	"fmt"
+	"microbatcher/pkg/configs"
+	"microbatcher/pkg/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolRouting(t *testing.T) {
+	tests := []struct {
+		name            string
+		strategy        RoutingStrategy
+		jobIds          []string
+		expectedResults []int
+	}{
+		{
+			name:            "Round robin spreads jobs evenly",
+			strategy:        RoutingRoundRobin,
+			jobIds:          []string{"job1", "job2", "job3", "job4", "job5", "job6"},
+			expectedResults: []int{2, 2, 2},
+		},
+		{
+			name:            "Consistent hash sends the same job ID to the same batcher",
+			strategy:        RoutingConsistentHash,
+			jobIds:          []string{"job1", "job1", "job1", "job1"},
+			expectedResults: []int{4},
+		},
+		{
+			name:            "Least queue depth picks an idle batcher",
+			strategy:        RoutingLeastQueueDepth,
+			jobIds:          []string{"job1"},
+			expectedResults: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewPool("pool", 3, &TestingMicroBatcherProcess[string]{}, configs.NewDefaultConfig(), tt.strategy)
+			assert.Nil(t, err)
+			assert.Nil(t, pool.Start())
+
+			for _, id := range tt.jobIds {
+				result, submitErr := pool.Submit(&types.Job[string, string]{ID: id})
+				assert.Nil(t, submitErr)
+				assert.Equal(t, id, result.ID)
+			}
+			assert.Nil(t, pool.Shutdown())
+
+			var results []int
+			for _, batcher := range pool.batchers {
+				if n := len(batcher.GetCurrentResults()); n > 0 {
+					results = append(results, n)
+				}
+			}
+			assert.Equal(t, tt.expectedResults, results)
+			assert.Len(t, pool.GetCurrentResults(), len(tt.jobIds))
+		})
+	}
+}
+
+func TestPoolFailover(t *testing.T) {
+	cfg, _ := configs.NewCustomConfig(2, 1, 100*time.Second)
+	pool, _ := NewPool("pool", 2, &TestingMicroBatcherProcess[string]{
+		slow:          true,
+		sleepDuration: 1 * time.Minute,
+	}, cfg, RoutingConsistentHash)
+	assert.Nil(t, pool.Start())
+
+	// each batcher blocks in its first batch and then queues two jobs, so the pool holds six jobs at most
+	var accepted int
+	var lastErr error
+	for i := 0; i < 8; i++ {
+		_, err := pool.Submit(&types.Job[string, string]{ID: fmt.Sprintf("job%d", i)})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		accepted++
+		// let the batcher take the job off the queue into its blocked batch
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 6, accepted)
+	assert.EqualError(t, lastErr, "job queue is full")
+}
+
+func TestNewPoolError(t *testing.T) {
+	pool, err := NewPool("pool", 0, &TestingMicroBatcherProcess[string]{}, configs.NewDefaultConfig(), RoutingRoundRobin)
+	assert.Nil(t, pool)
+	assert.EqualError(t, err, "pool size must be positive")
+}
+
+func TestPoolStartAndShutdownError(t *testing.T) {
+	pool, _ := NewPool("pool", 2, &TestingMicroBatcherProcess[string]{}, configs.NewDefaultConfig(), RoutingRoundRobin)
+	assert.Nil(t, pool.Start())
+	assert.EqualError(t, pool.Start(), "batcher is started already")
+	assert.Nil(t, pool.Shutdown())
+	assert.EqualError(t, pool.Shutdown(),
+		"pool-01: invalid shutdown since batcher is stopped\npool-02: invalid shutdown since batcher is stopped")
+}
@@ -0,0 +1,129 @@
+package microbatcher
+
+import (
+	"encoding/json"
+	"microbatcher/pkg/breaker"
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of the state of a batcher.
+type Stats struct {
+	Name             string
+	Running          bool
+	Paused           bool
+	QueueDepth       int
+	QueueCapacity    int
+	PendingBatchSize int
+	DelayedJobs      int
+	BatchesProcessed int
+	JobsProcessed    int
+	JobsFailed       int
+	JobsExpired      int
+	LastError        error
+	LastFlushTime    time.Time
+	BreakerState     breaker.State
+	BreakerCounts    breaker.Counts
+}
+
+type statsJSON struct {
+	Name             string            `json:"name"`
+	Running          bool              `json:"running"`
+	Paused           bool              `json:"paused"`
+	QueueDepth       int               `json:"queue_depth"`
+	QueueCapacity    int               `json:"queue_capacity"`
+	PendingBatchSize int               `json:"pending_batch_size"`
+	DelayedJobs      int               `json:"delayed_jobs"`
+	BatchesProcessed int               `json:"batches_processed"`
+	JobsProcessed    int               `json:"jobs_processed"`
+	JobsFailed       int               `json:"jobs_failed"`
+	JobsExpired      int               `json:"jobs_expired"`
+	LastError        string            `json:"last_error,omitempty"`
+	LastFlushTime    *time.Time        `json:"last_flush_time,omitempty"`
+	BreakerState     string            `json:"breaker_state"`
+	BreakerCounts    breakerCountsJSON `json:"breaker_counts"`
+}
+
+type breakerCountsJSON struct {
+	Successes   int `json:"successes"`
+	Failures    int `json:"failures"`
+	Rejections  int `json:"rejections"`
+	Transitions int `json:"transitions"`
+}
+
+// MarshalJSON encodes the stats with snake case keys. The last error is encoded by its message, and the last
+// error and flush time are omitted while unset.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	encoded := statsJSON{
+		Name:             s.Name,
+		Running:          s.Running,
+		Paused:           s.Paused,
+		QueueDepth:       s.QueueDepth,
+		QueueCapacity:    s.QueueCapacity,
+		PendingBatchSize: s.PendingBatchSize,
+		DelayedJobs:      s.DelayedJobs,
+		BatchesProcessed: s.BatchesProcessed,
+		JobsProcessed:    s.JobsProcessed,
+		JobsFailed:       s.JobsFailed,
+		JobsExpired:      s.JobsExpired,
+		BreakerState:     s.BreakerState.String(),
+		BreakerCounts:    breakerCountsJSON(s.BreakerCounts),
+	}
+	if s.LastError != nil {
+		encoded.LastError = s.LastError.Error()
+	}
+	if !s.LastFlushTime.IsZero() {
+		encoded.LastFlushTime = &s.LastFlushTime
+	}
+	return json.Marshal(encoded)
+}
+
+// metrics holds the counters of a batcher which are written by the batch process goroutine.
+type metrics struct {
+	mutex            sync.Mutex
+	pendingBatchSize int
+	batchesProcessed int
+	jobsProcessed    int
+	jobsFailed       int
+	jobsExpired      int
+	lastError        error
+	lastFlushTime    time.Time
+}
+
+func (m *metrics) setPendingBatchSize(size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.pendingBatchSize = size
+}
+
+// recordBatch counts a batch which is dispatched to the processor at the given time, and returns its sequence
+// number.
+func (m *metrics) recordBatch(flushTime time.Time) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.batchesProcessed++
+	m.lastFlushTime = flushTime
+	return m.batchesProcessed
+}
+
+// recordJobs counts the processed jobs, and keeps the last error unless it is nil.
+func (m *metrics) recordJobs(processed int, failed int, lastError error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.jobsProcessed += processed
+	m.jobsFailed += failed
+	if lastError != nil {
+		m.lastError = lastError
+	}
+}
+
+// recordExpired counts the jobs which expired before dispatch. They are counted as processed and failed jobs too.
+func (m *metrics) recordExpired(expired int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.jobsExpired += expired
+}
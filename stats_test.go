@@ -0,0 +1,124 @@
+package microbatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"microbatcher/pkg/breaker"
+	"microbatcher/pkg/clock"
+	"microbatcher/pkg/configs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMicroBatcherStats(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg, _ := configs.NewCustomConfig(10, 2, 5*time.Second)
+	cfg.SetClock(clock.NewFake(now))
+
+	processor := &TestingFailingMicroBatcherProcess[string]{}
+	processor.failures.Store(1)
+	mb := NewMicroBatcher("tester", processor, cfg)
+
+	assert.Equal(t, Stats{Name: "tester", QueueCapacity: 10}, mb.Stats())
+
+	assert.Nil(t, mb.Start())
+	assert.Nil(t, mb.Pause())
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		return mb.Stats().PendingBatchSize == len(jobs)
+	}, time.Second, time.Millisecond)
+
+	stats := mb.Stats()
+	assert.True(t, stats.Running)
+	assert.True(t, stats.Paused)
+	assert.Equal(t, 0, stats.QueueDepth)
+	assert.Equal(t, 0, stats.BatchesProcessed)
+
+	// the first batch of two jobs fails, the second batch of one job succeeds
+	assert.Nil(t, mb.Resume())
+	assert.Nil(t, mb.Flush(context.Background()))
+	assert.Nil(t, mb.Shutdown())
+
+	assert.Equal(t, Stats{
+		Name:             "tester",
+		QueueCapacity:    10,
+		BatchesProcessed: 2,
+		JobsProcessed:    3,
+		JobsFailed:       2,
+		LastError:        errors.New("downstream is down"),
+		LastFlushTime:    now,
+	}, mb.Stats())
+}
+
+func TestMicroBatcherStatsBreakerCounts(t *testing.T) {
+	breakerConfig, _ := breaker.NewCustomConfig(1, 1, 1, time.Minute, 1, breaker.PolicyFailFast)
+	cfg, _ := configs.NewCustomConfig(10, 1, time.Hour)
+	cfg.SetCircuitBreaker(breakerConfig)
+
+	processor := &TestingFailingMicroBatcherProcess[string]{}
+	processor.failures.Store(1)
+	mb := NewMicroBatcher("tester", processor, cfg)
+
+	assert.Equal(t, breaker.Counts{}, mb.Stats().BreakerCounts)
+
+	// the first batch fails and opens the breaker, which rejects the other two batches
+	assert.Nil(t, mb.Start())
+	for _, job := range jobs {
+		_, err := mb.Submit(job)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, mb.Shutdown())
+
+	stats := mb.Stats()
+	assert.Equal(t, breaker.StateOpen, stats.BreakerState)
+	assert.Equal(t, breaker.Counts{Failures: 1, Rejections: 2, Transitions: 1}, stats.BreakerCounts)
+}
+
+func TestStatsMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		stats    Stats
+		expected string
+	}{
+		{
+			name:  "Stats without last error and flush time",
+			stats: Stats{Name: "tester", Running: true, QueueDepth: 3, QueueCapacity: 10},
+			expected: `{"name":"tester","running":true,"paused":false,"queue_depth":3,"queue_capacity":10,` +
+				`"pending_batch_size":0,"delayed_jobs":0,"batches_processed":0,"jobs_processed":0,"jobs_failed":0,"jobs_expired":0,` +
+				`"breaker_state":"closed","breaker_counts":{"successes":0,"failures":0,"rejections":0,"transitions":0}}`,
+		},
+		{
+			name: "Stats with last error and flush time",
+			stats: Stats{
+				Name:             "tester",
+				Paused:           true,
+				PendingBatchSize: 2,
+				BatchesProcessed: 1,
+				JobsProcessed:    5,
+				JobsFailed:       1,
+				LastError:        errors.New("downstream is down"),
+				LastFlushTime:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				BreakerState:     breaker.StateOpen,
+				BreakerCounts:    breaker.Counts{Successes: 3, Failures: 1, Rejections: 2, Transitions: 1},
+			},
+			expected: `{"name":"tester","running":false,"paused":true,"queue_depth":0,"queue_capacity":0,` +
+				`"pending_batch_size":2,"delayed_jobs":0,"batches_processed":1,"jobs_processed":5,"jobs_failed":1,"jobs_expired":0,` +
+				`"last_error":"downstream is down","last_flush_time":"2024-01-01T00:00:00Z","breaker_state":"open",` +
+				`"breaker_counts":{"successes":3,"failures":1,"rejections":2,"transitions":1}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(tt.stats)
+			assert.Nil(t, err)
+			assert.JSONEq(t, tt.expected, string(encoded))
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package microbatcher
+
+import (
+	"microbatcher/pkg/types"
+	"sync"
+	"time"
+)
+
+// finishedJob is a job whose status is final, in order of finishing for the retention policy.
+type finishedJob[I types.JobId] struct {
+	id         I
+	finishedAt time.Time
+}
+
+// statusTracker keeps the lifecycle state of the jobs of a batcher by job ID. Jobs in flight are always tracked,
+// while finished jobs are kept by the retention policy, i.e. up to a max number of jobs and optionally for a TTL.
+// Statuses are stored as copies, so that the results handed out to processors and subscribers are not shared.
+type statusTracker[I types.JobId, T any] struct {
+	mutex    sync.Mutex
+	maxJobs  int
+	ttl      time.Duration
+	statuses map[I]*types.JobResult[I, T]
+	finished []finishedJob[I]
+}
+
+func newStatusTracker[I types.JobId, T any](maxJobs int, ttl time.Duration) *statusTracker[I, T] {
+	return &statusTracker[I, T]{
+		maxJobs:  maxJobs,
+		ttl:      ttl,
+		statuses: make(map[I]*types.JobResult[I, T]),
+	}
+}
+
+// submit tracks a submitted job by the result responding to its submission, and returns the status it replaces,
+// e.g. the retained status of a finished job with the same ID, or nil.
+func (st *statusTracker[I, T]) submit(result *types.JobResult[I, T]) *types.JobResult[I, T] {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	previous := st.statuses[result.ID]
+	status := *result
+	st.statuses[result.ID] = &status
+	return previous
+}
+
+// restore puts back the status which the submission of a rejected job replaced, or stops tracking the job when
+// there was none.
+func (st *statusTracker[I, T]) restore(id I, previous *types.JobResult[I, T]) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if previous == nil {
+		delete(st.statuses, id)
+		return
+	}
+	st.statuses[id] = previous
+}
+
+// queue marks the accepted jobs as queued, e.g. delayed jobs which are due. Jobs which are taken by a batch
+// already are left as they are.
+func (st *statusTracker[I, T]) queue(jobs ...*types.Job[I, T]) {
+	st.update(jobs, func(status *types.JobResult[I, T]) {
+		if status.Status == types.JobStatusAccepted {
+			status.Status = types.JobStatusQueued
+		}
+	})
+}
+
+// start marks the jobs as processing by the batch of the given sequence number.
+func (st *statusTracker[I, T]) start(jobs []*types.Job[I, T], startedAt time.Time, sequence int) {
+	st.update(jobs, func(status *types.JobResult[I, T]) {
+		status.Status = types.JobStatusProcessing
+		status.StartedAt = startedAt
+		status.BatchSequence = sequence
+	})
+}
+
+// update applies the change to the tracked jobs which are not finished yet.
+func (st *statusTracker[I, T]) update(jobs []*types.Job[I, T], change func(status *types.JobResult[I, T])) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	for _, job := range jobs {
+		if status, ok := st.statuses[job.ID]; ok && !status.Status.Done() {
+			change(status)
+		}
+	}
+}
+
+// finish stores the final results. Results are given the submission time of their jobs, since the processor
+// does not know it.
+func (st *statusTracker[I, T]) finish(results []*types.JobResult[I, T], now time.Time) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	for _, result := range results {
+		if tracked, ok := st.statuses[result.ID]; ok {
+			result.SubmittedAt = tracked.SubmittedAt
+		}
+		status := *result
+		st.statuses[result.ID] = &status
+		st.finished = append(st.finished, finishedJob[I]{id: result.ID, finishedAt: result.FinishedAt})
+	}
+	st.evict(now)
+}
+
+// drop finishes the jobs of a processed batch which are still not finished, since the processor returned no
+// result for them.
+func (st *statusTracker[I, T]) drop(jobs []*types.Job[I, T], now time.Time) int {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	dropped := 0
+	for _, job := range jobs {
+		if status, ok := st.statuses[job.ID]; ok && !status.Status.Done() {
+			status.Status = types.JobStatusDropped
+			status.FinishedAt = now
+			st.finished = append(st.finished, finishedJob[I]{id: job.ID, finishedAt: now})
+			dropped++
+		}
+	}
+	st.evict(now)
+	return dropped
+}
+
+// fail marks the finished job as failed afterwards.
+func (st *statusTracker[I, T]) fail(id I, err error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if status, ok := st.statuses[id]; ok && status.Status.Done() {
+		status.Errors = err
+		status.Status = types.JobStatusFailed
+	}
+}
+
+// forget stops tracking the jobs, e.g. delayed jobs which are taken out of the batcher.
+func (st *statusTracker[I, T]) forget(jobs ...*types.Job[I, T]) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	for _, job := range jobs {
+		delete(st.statuses, job.ID)
+	}
+}
+
+// status returns a copy of the tracked status of the job.
+func (st *statusTracker[I, T]) status(id I, now time.Time) (*types.JobResult[I, T], bool) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.evict(now)
+	tracked, ok := st.statuses[id]
+	if !ok {
+		return nil, false
+	}
+	status := *tracked
+	return &status, true
+}
+
+// evict forgets the oldest finished jobs beyond the max number of jobs or past the TTL. A job which is tracked
+// again in the meantime, e.g. since its ID is resubmitted, is kept. It must be called with the mutex held.
+func (st *statusTracker[I, T]) evict(now time.Time) {
+	for len(st.finished) > 0 {
+		oldest := st.finished[0]
+		if len(st.finished) <= st.maxJobs && (st.ttl <= 0 || now.Before(oldest.finishedAt.Add(st.ttl))) {
+			return
+		}
+
+		st.finished[0] = finishedJob[I]{}
+		st.finished = st.finished[1:]
+		if status, ok := st.statuses[oldest.id]; ok && status.Status.Done() && status.FinishedAt.Equal(oldest.finishedAt) {
+			delete(st.statuses, oldest.id)
+		}
+	}
+}